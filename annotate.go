@@ -0,0 +1,227 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// annotatedNode, annotatedEdge and annotatedGraph represent the module
+// graph annotated with metadata such as versions, groups and whether
+// requirements are indirect. They are used by the dot template and the
+// export formats.
+type annotatedNode struct {
+	Module   string
+	Version  string          // empty if the selected versions were not loaded.
+	Group    string          // set if --group-by is specified.
+	Color    string          // fill color, if any.
+	Root     bool            // true for the main module.
+	Selected bool            // selected by minimal version selection.
+	Metadata *moduleMetadata // set if --metadata is specified.
+	Usage    moduleUsage     // set if --classify is specified.
+}
+
+// Deprecated returns true if the module is deprecated or its version
+// has been retracted.
+func (n annotatedNode) Deprecated() bool {
+	return n.Metadata != nil && (len(n.Metadata.Deprecated) > 0 || n.Metadata.Retracted)
+}
+
+// Description returns a summary of the node's metadata, one item per
+// line, escaped for use within a quoted dot tooltip.
+func (n annotatedNode) Description() string {
+	md := n.Metadata
+	if md == nil {
+		return ""
+	}
+	lines := []string{}
+	if len(md.GoVersion) > 0 {
+		lines = append(lines, "go "+md.GoVersion)
+	}
+	if !md.Time.IsZero() {
+		lines = append(lines, "released "+md.Time.Format("2006-01-02"))
+	}
+	if md.Packages > 0 {
+		lines = append(lines, fmt.Sprintf("%v packages, %v bytes", md.Packages, md.Size))
+	}
+	if len(md.Deprecated) > 0 {
+		lines = append(lines, "deprecated: "+md.Deprecated)
+	}
+	if md.Retracted {
+		lines = append(lines, "retracted: "+md.Rationale)
+	}
+	for i, l := range lines {
+		lines[i] = dotEscaper.Replace(l)
+	}
+	return strings.Join(lines, `\n`)
+}
+
+// dotEscaper escapes text for use within a quoted dot string.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type annotatedEdge struct {
+	Module    string
+	DependsOn string
+	Versions  []string // the required versions of DependsOn.
+	Label     string   // set for dot output if --edge-labels is specified.
+	Indirect  bool     // true if all requirements are // indirect.
+	TestOnly  bool     // true if DependsOn is only imported by tests.
+}
+
+type annotatedGroup struct {
+	Name  string
+	Color string
+}
+
+// annotatedGraph is the data that the dot template, including any custom
+// template specified by --template, is executed with, and hence its
+// exported fields and methods, and those of the types it refers to, must
+// remain stable. Nodes includes the root module and is in the order in
+// which modules first appear in the output of go mod graph, Dependencies
+// is sorted by module and then by dependency.
+type annotatedGraph struct {
+	Root         string
+	RankDir      string
+	Layout       string
+	Legend       bool
+	Metadata     bool // true if nodes have metadata.
+	Usage        bool // true if nodes have been classified.
+	Groups       []annotatedGroup
+	Clusters     []cluster
+	Nodes        []annotatedNode
+	Dependencies []annotatedEdge
+}
+
+func rgbColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// newAnnotatedGraph creates an annotated graph from the raw
+// dependencies, the selected module versions and the module cache. If
+// selected is nil all modules are considered to be selected. If mc is
+// nil the requirements are not loaded and the edges have no versions
+// and are not marked as indirect.
+func newAnnotatedGraph(root string, raw []dependency, selected map[string]string, mc *modCache, grp grouper, metadata map[string]*moduleMetadata) (*annotatedGraph, error) {
+	dependencies, unique, ordered := processGraph(raw, graphState.Versioned)
+	var reqs map[dependency]*requirement
+	if mc != nil {
+		var err error
+		if reqs, err = getRequirements(mc, raw, graphState.Versioned); err != nil {
+			return nil, err
+		}
+	}
+	graph := &annotatedGraph{Root: root, Metadata: metadata != nil}
+	groups := map[string]string{}
+	if grp != nil {
+		graph.Clusters = clusters(unique, grp)
+		for i, c := range graph.Clusters {
+			col := rgbColor(hslColor(float64(i)/float64(len(graph.Clusters)), 0.9, 0.8))
+			groups[c.Name] = col
+			graph.Groups = append(graph.Groups, annotatedGroup{Name: c.Name, Color: col})
+		}
+	}
+	for _, m := range ordered {
+		node := annotatedNode{
+			Module:   m,
+			Version:  moduleVersion(m, selected),
+			Root:     m == root,
+			Metadata: metadata[m],
+		}
+		path := stripVersion(m)
+		_, ok := selected[path]
+		node.Selected = node.Root || isPseudoModule(m) || ok || selected == nil
+		if graphState.Versioned && !node.Root && !isPseudoModule(m) && selected != nil {
+			node.Selected = selected[path] == node.Version
+		}
+		if grp != nil {
+			node.Group = grp(m)
+			node.Color = groups[node.Group]
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	for _, dep := range dependencies {
+		edge := annotatedEdge{Module: dep.Module, DependsOn: dep.DependsOn}
+		if req := reqs[dep]; req != nil {
+			edge.Versions = req.Versions
+			edge.Indirect = req.Indirect
+		}
+		graph.Dependencies = append(graph.Dependencies, edge)
+	}
+	sort.Slice(graph.Dependencies, func(i, j int) bool {
+		if graph.Dependencies[i].Module == graph.Dependencies[j].Module {
+			return graph.Dependencies[i].DependsOn < graph.Dependencies[j].DependsOn
+		}
+		return graph.Dependencies[i].Module < graph.Dependencies[j].Module
+	})
+	return graph, nil
+}
+
+// classify records the usage of each module and marks the dependencies
+// on modules that are only imported by tests.
+func (ag *annotatedGraph) classify(usage map[string]moduleUsage) {
+	ag.Usage = true
+	for i, n := range ag.Nodes {
+		ag.Nodes[i].Usage = usage[n.Module]
+	}
+	for i, e := range ag.Dependencies {
+		ag.Dependencies[i].TestOnly = usage[e.DependsOn] == usageTest
+	}
+}
+
+// loadAnnotatedGraph runs the go commands needed to create an annotated
+// graph for the current module. If versions is false, the versions selected
+// by minimal version selection are only loaded if --versioned, --metadata
+// or --classify require them since every module in an unversioned graph
+// is selected. The requirements, and hence the go.mod files, are only
+// read if requirements is true.
+func loadAnnotatedGraph(ctx context.Context, versions, requirements bool) (*annotatedGraph, error) {
+	root, err := getRoot(ctx, goCmd{})
+	if err != nil {
+		return nil, err
+	}
+	raw, _, _, err := getGraph(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	var selected map[string]string
+	if versions || graphState.Versioned || graphState.Metadata || graphState.Classify {
+		if selected, err = getSelectedVersions(ctx, goCmd{}); err != nil {
+			return nil, err
+		}
+	}
+	var mc *modCache
+	if requirements {
+		if mc, err = newModCache(ctx); err != nil {
+			return nil, err
+		}
+	}
+	grp, err := newGrouper(graphState.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	_, _, ordered := processGraph(raw, graphState.Versioned)
+	var metadata map[string]*moduleMetadata
+	if graphState.Metadata {
+		if metadata, err = loadMetadata(ctx, ordered, selected); err != nil {
+			return nil, err
+		}
+	}
+	graph, err := newAnnotatedGraph(root, raw, selected, mc, grp, metadata)
+	if err != nil {
+		return nil, err
+	}
+	if graphState.Classify {
+		usage, err := loadUsage(ctx, ordered, selected)
+		if err != nil {
+			return nil, err
+		}
+		graph.classify(usage)
+	}
+	return graph, nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/modfile"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphCacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manage the cache of go command output",
+	Long: `The output of go mod graph, go list -m and go list -m all is cached in the
+user's cache directory, keyed by the go version and the contents of the go.mod,
+go.sum and go.work files, including the go.mod files of workspace modules and
+local replacements, so that repeated invocations need not rerun them. The least
+recently used entries are removed once the cache exceeds 64MiB. Use --no-cache
+to bypass the cache.`,
+}
+
+var graphCacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "remove all cached go command output",
+	Args:  cobra.NoArgs,
+	RunE:  graphCacheClean,
+}
+
+func init() {
+	graphCmd.AddCommand(graphCacheCmd)
+	graphCacheCmd.AddCommand(graphCacheCleanCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphCmd.PersistentFlags(), "cache", &graphState, nil, nil))
+}
+
+// graphCache stores the output of go commands for a specific module
+// configuration, as identified by key.
+type graphCache struct {
+	dir string
+	key string
+}
+
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gomodgraph"), nil
+}
+
+// maxCacheSize is the total size, in bytes, of the cache entries beyond
+// which the least recently used entries are removed.
+var maxCacheSize int64 = 64 << 20
+
+// localReplacements returns the go.mod files of the local directories,
+// relative to dir, that modules are replaced by.
+func localReplacements(dir string, replacements []string) []string {
+	files := []string{}
+	for _, path := range replacements {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		files = append(files, filepath.Join(path, "go.mod"))
+	}
+	return files
+}
+
+// replaceDirectories returns the local directories named by the replace
+// directives in a go.mod file, ie. those without a version. The syntax
+// tree is used since modfile.ParseLax ignores replace directives.
+func replaceDirectories(f *modfile.File) []string {
+	dirs := []string{}
+	add := func(tokens []string) {
+		for i, tok := range tokens {
+			if tok != "=>" || len(tokens) != i+2 {
+				continue
+			}
+			dir := tokens[i+1]
+			if unquoted, err := strconv.Unquote(dir); err == nil {
+				dir = unquoted
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, stmt := range f.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			if len(x.Token) > 0 && x.Token[0] == "replace" {
+				add(x.Token[1:])
+			}
+		case *modfile.LineBlock:
+			if len(x.Token) == 1 && x.Token[0] == "replace" {
+				for _, l := range x.Line {
+					add(l.Token)
+				}
+			}
+		}
+	}
+	return dirs
+}
+
+// moduleFiles returns the files that determine the module graph: the
+// go.mod and go.sum files in use, the go.work and go.work.sum files if a
+// workspace is in use and the go.mod files of the workspace's modules and
+// of the local directories that any of these modules are replaced by.
+func moduleFiles(gomod, gosum, gowork string) []string {
+	files := []string{gomod, gosum}
+	mains := []string{gomod}
+	if len(gowork) > 0 && gowork != "off" {
+		files = append(files, gowork, gowork+".sum")
+		if buf, err := ioutil.ReadFile(gowork); err == nil {
+			if wf, err := modfile.ParseWork(gowork, buf, nil); err == nil {
+				dir := filepath.Dir(gowork)
+				for _, u := range wf.Use {
+					path := u.Path
+					if !filepath.IsAbs(path) {
+						path = filepath.Join(dir, path)
+					}
+					mains = append(mains, filepath.Join(path, "go.mod"))
+				}
+				replaced := []string{}
+				for _, r := range wf.Replace {
+					if len(r.New.Version) == 0 {
+						replaced = append(replaced, r.New.Path)
+					}
+				}
+				files = append(files, localReplacements(dir, replaced)...)
+			}
+		}
+	}
+	for _, m := range mains {
+		files = append(files, m)
+		buf, err := ioutil.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		if f, err := modfile.ParseLax(m, buf, nil); err == nil {
+			files = append(files, localReplacements(filepath.Dir(m), replaceDirectories(f))...)
+		}
+	}
+	unique := make([]string, 0, len(files))
+	seen := map[string]bool{}
+	for _, f := range files {
+		if !seen[f] {
+			seen[f] = true
+			unique = append(unique, f)
+		}
+	}
+	return unique
+}
+
+// cacheKey returns a hash of the go command and its version, the go flags,
+// GOOS, GOARCH and the go.mod, go.sum, go.work and go.work.sum files in use
+// including the go.mod files of workspace modules and local replacements.
+func cacheKey(ctx context.Context) (string, error) {
+	env, err := getGoEnv(ctx, "GOVERSION", "GOWORK", "GOFLAGS", "GOOS", "GOARCH")
+	if err != nil {
+		return "", err
+	}
+	gomod, gosum, err := getGoMod(ctx)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%v\n%v\n%v\n%v\n%v\n%v\n%v\n", goCommand(), env["GOVERSION"], gomod, env["GOWORK"], env["GOFLAGS"], env["GOOS"], env["GOARCH"])
+	for _, f := range moduleFiles(gomod, gosum, env["GOWORK"]) {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		fmt.Fprintf(h, "%v %v\n", f, len(buf))
+		h.Write(buf)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var defaultGraphCache struct {
+	initialized bool
+	cache       *graphCache
+}
+
+// cacheFor returns the cache to use for the supplied go command, or nil
+// if caching is disabled or not possible. Only the go command for the
+// current directory and environment is cached.
+func cacheFor(ctx context.Context, gc goCmd) *graphCache {
+	if graphState.NoCache || len(gc.Dir) > 0 || len(gc.Env) > 0 {
+		return nil
+	}
+	if defaultGraphCache.initialized {
+		return defaultGraphCache.cache
+	}
+	defaultGraphCache.initialized = true
+	dir, err := cacheDir()
+	if err != nil {
+		return nil
+	}
+	key, err := cacheKey(ctx)
+	if err != nil {
+		return nil
+	}
+	defaultGraphCache.cache = &graphCache{dir: dir, key: key}
+	return defaultGraphCache.cache
+}
+
+func (c *graphCache) filename(name string) string {
+	return filepath.Join(c.dir, c.key+"-"+name+".json")
+}
+
+// get reads the named entry into v, returning false if there is no such
+// entry or it cannot be read. The entry's modification time is updated
+// so that the least recently used entries are evicted first.
+func (c *graphCache) get(name string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	filename := c.filename(name)
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	os.Chtimes(filename, now, now)
+	return json.Unmarshal(buf, v) == nil
+}
+
+// put writes v as the named entry. Failures are ignored since the cache
+// is only an optimization.
+func (c *graphCache) put(name string, v interface{}) {
+	if c == nil {
+		return
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(c.dir, name)
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(buf)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.filename(name)); err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	c.evict()
+}
+
+// evict removes the least recently used entries, for any key, once their
+// total size exceeds maxCacheSize.
+func (c *graphCache) evict() {
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().After(entries[j].ModTime())
+	})
+	var size int64
+	for _, e := range entries {
+		if size += e.Size(); size > maxCacheSize {
+			os.Remove(filepath.Join(c.dir, e.Name()))
+		}
+	}
+}
+
+func graphCacheClean(cmd *cobra.Command, args []string) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
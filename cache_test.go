@@ -0,0 +1,163 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestModuleFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.work": "go 1.21\n\nuse (\n\t./app\n\t./lib\n)\n\nreplace example.com/w => ./w\n",
+		"app/go.mod": `module example.com/app
+
+require example.com/x v1.0.0
+
+replace (
+	example.com/x => ../x
+	example.com/y v1.0.0 => example.com/z v1.1.0
+)
+`,
+		"lib/go.mod": "module example.com/lib\n\nreplace example.com/x => ../x\n",
+		"x/go.mod":   "module example.com/x\n\nreplace example.com/ignored => ./ignored\n",
+	})
+	join := func(name string) string { return filepath.Join(dir, name) }
+	gomod, gosum := join("app/go.mod"), join("app/go.sum")
+
+	if got, want := moduleFiles(gomod, gosum, ""), []string{gomod, gosum, join("x/go.mod")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := moduleFiles(gomod, gosum, "off"), []string{gomod, gosum, join("x/go.mod")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := moduleFiles(gomod, gosum, join("go.work")), []string{
+		gomod, gosum,
+		join("go.work"), join("go.work.sum"),
+		join("w/go.mod"),
+		join("x/go.mod"),
+		join("lib/go.mod"),
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":   "module example.com/app\n\nrequire example.com/x v1.0.0\n\nreplace example.com/x => ./x\n",
+		"go.sum":   "",
+		"x/go.mod": "module example.com/x\n",
+		"x/x.go":   "package x\n",
+	})
+	defer func(gc string) { graphState.GoCommand = gc }(graphState.GoCommand)
+	graphState.GoCommand = fakeGo(t, dir)
+	ctx := context.Background()
+	key := func() string {
+		k, err := cacheKey(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	original := key()
+	if got, want := key(), original; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	writeFiles(t, dir, map[string]string{"x/x.go": "package x\n\nconst X = 1\n"})
+	if got, want := key(), original; got != want {
+		t.Errorf("source changes should not change the key: got %v, want %v", got, want)
+	}
+	writeFiles(t, dir, map[string]string{"x/go.mod": "module example.com/x\n\nrequire example.com/y v1.0.0\n"})
+	replaced := key()
+	if replaced == original {
+		t.Errorf("changing a local replacement's go.mod should change the key")
+	}
+	writeFiles(t, dir, map[string]string{"go.sum": "example.com/y v1.0.0 h1:x\n"})
+	if key() == replaced {
+		t.Errorf("changing go.sum should change the key")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	defer func(size int64) { maxCacheSize = size }(maxCacheSize)
+	dir := t.TempDir()
+	cache := &graphCache{dir: dir, key: "k"}
+	value := map[string]string{"example.com/a": "v1.0.0"}
+	cache.put("first", value)
+	fi, err := os.Stat(cache.filename("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Allow for two entries.
+	maxCacheSize = 2 * fi.Size()
+	past := time.Now().Add(-time.Hour)
+	cache.put("second", value)
+	for _, name := range []string{"first", "second"} {
+		if err := os.Chtimes(cache.filename(name), past, past); err != nil {
+			t.Fatal(err)
+		}
+		past = past.Add(time.Minute)
+	}
+	// Reading first makes second the least recently used entry.
+	var got map[string]string
+	if !cache.get("first", &got) || !reflect.DeepEqual(got, value) {
+		t.Errorf("got %v, want %v", got, value)
+	}
+	cache.put("third", value)
+	for _, tc := range []struct {
+		name   string
+		exists bool
+	}{
+		{"first", true},
+		{"second", false},
+		{"third", true},
+	} {
+		if got, want := cache.get(tc.name, &got), tc.exists; got != want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestFakeGoCacheClean(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir, err := cacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &graphCache{dir: dir, key: "k"}
+	cache.put("selected", map[string]string{"example.com/a": "v1.0.0"})
+	if _, err := os.Stat(cache.filename("selected")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGodep(t, "small", "graph", "cache", "clean"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%v was not removed: %v", dir, err)
+	}
+	// Cleaning an empty, or missing, cache is not an error.
+	if _, err := runGodep(t, "small", "graph", "cache", "clean"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+)
+
+// compactGraph is an integer indexed representation of the dependency
+// graph that uses compressed sparse row (CSR) adjacency lists. Modules are
+// interned in sorted order so that the neighbour lists, which are sorted
+// by index and contain no duplicates, are also sorted by module name.
+// The dependencies of node n are deps[depOffsets[n]:depOffsets[n+1]] and
+// its dependents are rdeps[rdepOffsets[n]:rdepOffsets[n+1]].
+type compactGraph struct {
+	modules     []string
+	index       map[string]int32
+	depOffsets  []int32
+	deps        []int32
+	rdepOffsets []int32
+	rdeps       []int32
+}
+
+// newCompactGraph creates a compact graph from the graph's nodes.
+func newCompactGraph(gr *graph) *compactGraph {
+	cg := &compactGraph{
+		modules: make([]string, 0, len(gr.nodes)),
+		index:   make(map[string]int32, len(gr.nodes)),
+	}
+	for m := range gr.nodes {
+		cg.modules = append(cg.modules, m)
+	}
+	sort.Strings(cg.modules)
+	for i, m := range cg.modules {
+		cg.index[m] = int32(i)
+	}
+	adjacency := func(follow func(gn *graphNode) []*graphNode) ([]int32, []int32) {
+		offsets := make([]int32, len(cg.modules)+1)
+		edges := []int32{}
+		for i, m := range cg.modules {
+			start := len(edges)
+			for _, n := range follow(gr.nodes[m]) {
+				edges = append(edges, cg.index[n.module])
+			}
+			neighbours := edges[start:]
+			sort.Slice(neighbours, func(i, j int) bool { return neighbours[i] < neighbours[j] })
+			// Remove duplicates in place.
+			unique := start
+			for j := start; j < len(edges); j++ {
+				if j == start || edges[j] != edges[j-1] {
+					edges[unique] = edges[j]
+					unique++
+				}
+			}
+			edges = edges[:unique]
+			offsets[i+1] = int32(len(edges))
+		}
+		return offsets, edges
+	}
+	cg.depOffsets, cg.deps = adjacency(func(gn *graphNode) []*graphNode { return gn.dependencies })
+	cg.rdepOffsets, cg.rdeps = adjacency(func(gn *graphNode) []*graphNode { return gn.dependents })
+	return cg
+}
+
+// compact returns the compact representation of the graph, creating it
+// on first use.
+func (gr *graph) compact() *compactGraph {
+	if gr.compacted == nil {
+		gr.compacted = newCompactGraph(gr)
+	}
+	return gr.compacted
+}
+
+func (cg *compactGraph) dependencies(n int32) []int32 {
+	return cg.deps[cg.depOffsets[n]:cg.depOffsets[n+1]]
+}
+
+func (cg *compactGraph) dependents(n int32) []int32 {
+	return cg.rdeps[cg.rdepOffsets[n]:cg.rdepOffsets[n+1]]
+}
+
+// compactTreeNode is the compact equivalent of treeNode, children are
+// sorted by module name and cycle is -1 if no cycle was detected.
+type compactTreeNode struct {
+	module   int32
+	cycle    int32
+	children []*compactTreeNode
+}
+
+// flatten creates the tree of dependencies, or dependents, of start. Each
+// module's neighbours are expanded only the first time it is visited and
+// a module is marked as being part of a cycle with the first of its
+// neighbours that is on the path from start to it.
+func (cg *compactGraph) flatten(start int32, dependencies bool) *compactTreeNode {
+	follow := cg.dependents
+	if dependencies {
+		follow = cg.dependencies
+	}
+	visited := make([]bool, len(cg.modules))
+	onPath := make([]bool, len(cg.modules))
+	var visit func(c *compactTreeNode)
+	visit = func(c *compactTreeNode) {
+		visited[c.module] = true
+		onPath[c.module] = true
+		neighbours := follow(c.module)
+		c.children = make([]*compactTreeNode, len(neighbours))
+		for i, n := range neighbours {
+			dt := &compactTreeNode{module: n, cycle: -1}
+			if onPath[n] {
+				if c.cycle < 0 {
+					c.cycle = n
+				}
+			} else if !visited[n] {
+				visit(dt)
+			}
+			c.children[i] = dt
+		}
+		onPath[c.module] = false
+	}
+	root := &compactTreeNode{module: start, cycle: -1}
+	visit(root)
+	return root
+}
+
+// filter is the compact equivalent of filter.
+func (ct *compactTreeNode) filter(match func(module int32) bool, matched bool) *compactTreeNode {
+	mod := &compactTreeNode{module: ct.module, cycle: -1}
+	if matched = matched || match(ct.module); matched {
+		mod.children = ct.children
+		return mod
+	}
+	if len(ct.children) == 0 {
+		return nil
+	}
+	for _, c := range ct.children {
+		if m := c.filter(match, matched); m != nil {
+			mod.children = append(mod.children, m)
+		}
+	}
+	if len(mod.children) == 0 {
+		return nil
+	}
+	return mod
+}
+
+// treeNode converts a compact tree to a treeNode.
+func (cg *compactGraph) treeNode(ct *compactTreeNode) *treeNode {
+	if ct == nil {
+		return nil
+	}
+	tn := &treeNode{Module: cg.modules[ct.module]}
+	if ct.cycle >= 0 {
+		tn.Cycle = cg.modules[ct.cycle]
+	}
+	if ct.children != nil {
+		tn.Children = make(map[string]*treeNode, len(ct.children))
+		for _, c := range ct.children {
+			tn.Children[cg.modules[c.module]] = cg.treeNode(c)
+		}
+	}
+	return tn
+}
@@ -0,0 +1,243 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// syntheticGraph returns a versioned graph with the specified number of
+// modules, each of which depends on up to fanout others. Most edges point
+// to modules later in the order, some point back to create cycles.
+func syntheticGraph(size, fanout int) ([]dependency, map[string]bool, []string) {
+	rnd := rand.New(rand.NewSource(int64(size)))
+	ordered := make([]string, size)
+	unique := make(map[string]bool, size)
+	for i := range ordered {
+		ordered[i] = fmt.Sprintf("example.com/org%v/mod%v@v1.%v.0", i%97, i, i%7)
+		unique[ordered[i]] = true
+	}
+	dependencies := []dependency{}
+	seen := map[[2]int]bool{}
+	for i := 0; i < size-1; i++ {
+		for j := 0; j < rnd.Intn(fanout+1); j++ {
+			to := i + 1 + rnd.Intn(size-i-1)
+			if rnd.Intn(50) == 0 {
+				to = rnd.Intn(i + 1)
+			}
+			if to == i || seen[[2]int{i, to}] {
+				continue
+			}
+			seen[[2]int{i, to}] = true
+			dependencies = append(dependencies, dependency{Module: ordered[i], DependsOn: ordered[to]})
+		}
+	}
+	return dependencies, unique, ordered
+}
+
+func mustBuildGraph(t testing.TB, size, fanout int) (*graph, []dependency, []string) {
+	dependencies, unique, ordered := syntheticGraph(size, fanout)
+	gr, err := buildGraph(dependencies, unique, &diagnostics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gr, dependencies, ordered
+}
+
+// mapFlatten is a map based tree walk, it is used as an oracle for the
+// compact graph. visited records whether a module has been expanded and,
+// if so, whether it is on the current path.
+func mapFlatten(gr *graph, c *treeNode, follow func(gn *graphNode) []*graphNode, visited map[string]bool) {
+	gn := gr.nodes[c.Module]
+	visited[c.Module] = true
+	c.Children = map[string]*treeNode{}
+	neighbours := append([]*graphNode{}, follow(gn)...)
+	sort.Slice(neighbours, func(i, j int) bool {
+		return neighbours[i].module < neighbours[j].module
+	})
+	for _, dep := range neighbours {
+		dt := &treeNode{Module: dep.module}
+		onPath, ok := visited[dep.module]
+		switch {
+		case onPath:
+			if len(c.Cycle) == 0 {
+				c.Cycle = dep.module
+			}
+		case !ok:
+			mapFlatten(gr, dt, follow, visited)
+		}
+		c.Children[dep.module] = dt
+	}
+	visited[c.Module] = false
+}
+
+func mapQueryTree(gr *graph, start, contains string, dependencies bool) *treeNode {
+	follow := func(gn *graphNode) []*graphNode { return gn.dependents }
+	if dependencies {
+		follow = func(gn *graphNode) []*graphNode { return gn.dependencies }
+	}
+	dt := &treeNode{Module: start}
+	mapFlatten(gr, dt, follow, map[string]bool{})
+	if len(contains) > 0 {
+		return filter(dt, func(tn *treeNode) bool {
+			return tn.Module == contains
+		}, false)
+	}
+	return dt
+}
+
+// denseMatrix is the original map based, dense, construction of the
+// dependency matrix, it is used as an oracle for newCompactDM.
+func denseMatrix(modules []string, deps []dependency) [][]byte {
+	index := make(map[string]int, len(modules))
+	rows := make([][]byte, len(modules))
+	cells := make([]byte, len(modules)*len(modules))
+	for i, m := range modules {
+		index[m] = i
+		rows[i] = cells[i*len(modules) : (i+1)*len(modules) : (i+1)*len(modules)]
+	}
+	for _, dep := range deps {
+		rows[index[dep.Module]][index[dep.DependsOn]] = 0x1
+	}
+	return rows
+}
+
+// denseMatrixString formats a dense matrix in the same way as
+// dependencyMatrix.matrix.
+func denseMatrixString(rows [][]byte) string {
+	var out strings.Builder
+	out.WriteString("[")
+	for i, row := range rows {
+		out.WriteString("[")
+		for j, val := range row {
+			if j > 0 {
+				out.WriteString(",")
+			}
+			if val > 0 {
+				out.WriteString("1")
+			} else {
+				out.WriteString("0")
+			}
+		}
+		out.WriteString("]")
+		if i < len(rows)-1 {
+			out.WriteString(",\n")
+		}
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+func TestCompactDM(t *testing.T) {
+	gr, dependencies, ordered := mustBuildGraph(t, 500, 6)
+	// The matrix order need not be the compact graph's sorted order.
+	rand.New(rand.NewSource(1)).Shuffle(len(ordered), func(i, j int) {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	})
+	dm := newCompactDM(gr.compact(), ordered)
+	want := denseMatrix(ordered, dependencies)
+	for i := range ordered {
+		got := make([]byte, len(ordered))
+		for _, c := range dm.cols[dm.offsets[i]:dm.offsets[i+1]] {
+			got[c] = 0x1
+		}
+		if !bytes.Equal(got, want[i]) {
+			t.Errorf("%v: compact and dense rows differ", ordered[i])
+		}
+	}
+	if got, want := dm.matrix(), denseMatrixString(want); got != want {
+		t.Errorf("compact and dense matrices differ")
+	}
+}
+
+func TestCompactGraph(t *testing.T) {
+	gr, _, ordered := mustBuildGraph(t, 2000, 6)
+	for _, tc := range []struct {
+		start, contains string
+		dependencies    bool
+	}{
+		{ordered[0], "", true},
+		{ordered[0], ordered[1500], true},
+		{ordered[10], ordered[20], true},
+		{ordered[1999], "", false},
+		{ordered[1999], ordered[300], false},
+	} {
+		want := mapQueryTree(gr, tc.start, tc.contains, tc.dependencies)
+		got := gr.queryTree(tc.start, tc.contains, tc.dependencies)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v %v %v: compact and map based trees differ", tc.start, tc.contains, tc.dependencies)
+		}
+	}
+}
+
+const (
+	benchmarkSize   = 20000
+	benchmarkFanout = 8
+)
+
+// The flatten and filter benchmarks include the conversion of the compact
+// tree to a treeNode since that is what queries return.
+
+func BenchmarkFlattenMap(b *testing.B) {
+	gr, _, ordered := mustBuildGraph(b, benchmarkSize, benchmarkFanout)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mapQueryTree(gr, ordered[0], "", true)
+	}
+}
+
+func BenchmarkFlattenCompact(b *testing.B) {
+	gr, _, ordered := mustBuildGraph(b, benchmarkSize, benchmarkFanout)
+	gr.compact()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gr.queryTree(ordered[0], "", true)
+	}
+}
+
+func BenchmarkFilterMap(b *testing.B) {
+	gr, _, ordered := mustBuildGraph(b, benchmarkSize, benchmarkFanout)
+	contains := ordered[benchmarkSize/2]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mapQueryTree(gr, ordered[0], contains, true)
+	}
+}
+
+func BenchmarkFilterCompact(b *testing.B) {
+	gr, _, ordered := mustBuildGraph(b, benchmarkSize, benchmarkFanout)
+	gr.compact()
+	contains := ordered[benchmarkSize/2]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gr.queryTree(ordered[0], contains, true)
+	}
+}
+
+// The matrix benchmarks include formatting the matrix since the wheel
+// needs the formatted matrix and the compact matrix is never dense.
+
+func BenchmarkMatrixMap(b *testing.B) {
+	_, dependencies, ordered := mustBuildGraph(b, benchmarkSize/4, benchmarkFanout)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		denseMatrixString(denseMatrix(ordered, dependencies))
+	}
+}
+
+func BenchmarkMatrixCompact(b *testing.B) {
+	gr, _, ordered := mustBuildGraph(b, benchmarkSize/4, benchmarkFanout)
+	cg := gr.compact()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newCompactDM(cg, ordered).matrix()
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var graphDeprecatedCmd = &cobra.Command{
+	Use:   "deprecated",
+	Short: "display deprecated modules and retracted module versions and the paths that require them",
+	Long: `display the modules that are deprecated, that is, whose newest go.mod
+file available locally has a // Deprecated: comment, and the modules whose
+selected version is retracted by the newest version available locally. The
+shortest path from the root to each such module is displayed to identify the
+dependency that needs to be updated. Use --metadata with the dot and itree
+commands to highlight these modules in graphs.`,
+	RunE: graphDeprecated,
+}
+
+func init() {
+	graphCmd.AddCommand(graphDeprecatedCmd)
+}
+
+// shortestPath returns the shortest path of dependencies from one module
+// to another, or nil if there is no such path.
+func (gr *graph) shortestPath(from, to string) []string {
+	if gr.nodes[from] == nil {
+		return nil
+	}
+	previous := map[string]string{from: ""}
+	queue := []*graphNode{gr.nodes[from]}
+	for len(queue) > 0 {
+		gn := queue[0]
+		queue = queue[1:]
+		if gn.module == to {
+			path := []string{}
+			for m := to; len(m) > 0; m = previous[m] {
+				path = append([]string{m}, path...)
+			}
+			return path
+		}
+		deps := append([]*graphNode{}, gn.dependencies...)
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].module < deps[j].module
+		})
+		for _, dep := range deps {
+			if _, ok := previous[dep.module]; !ok {
+				previous[dep.module] = gn.module
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil
+}
+
+func graphDeprecated(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	root, err := getRoot(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	dependencies, unique, ordered, err := getGraph(ctx, false)
+	if err != nil {
+		return err
+	}
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return err
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	metadata, err := loadMetadata(ctx, ordered, selected)
+	if err != nil {
+		return err
+	}
+	modules := make([]string, 0, len(metadata))
+	for m, md := range metadata {
+		if len(md.Deprecated) > 0 || md.Retracted {
+			modules = append(modules, m)
+		}
+	}
+	out := cmd.OutOrStdout()
+	sort.Strings(modules)
+	for _, m := range modules {
+		md := metadata[m]
+		if v := selected[m]; len(v) > 0 {
+			fmt.Fprintf(out, "%v@%v\n", m, v)
+		} else {
+			fmt.Fprintf(out, "%v\n", m)
+		}
+		if len(md.Deprecated) > 0 {
+			fmt.Fprintf(out, "  deprecated: %v\n", md.Deprecated)
+		}
+		if md.Retracted {
+			fmt.Fprintf(out, "  retracted: %v\n", md.Rationale)
+		}
+		if path := graph.shortestPath(root, m); len(path) > 1 {
+			fmt.Fprintf(out, "  path: %v\n", strings.Join(path, " -> "))
+		}
+	}
+	return nil
+}
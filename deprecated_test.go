@@ -0,0 +1,67 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShortestPath(t *testing.T) {
+	for _, tc := range []struct {
+		fixture   string
+		versioned bool
+		from, to  string
+		path      []string
+	}{
+		{"small", false, "example.com/app", "golang.org/x/text", []string{"example.com/app", "golang.org/x/text"}},
+		{"small", false, "example.com/a", "golang.org/x/text", []string{"example.com/a", "example.com/c", "golang.org/x/text"}},
+		{"small", false, "example.com/app", "example.com/app", []string{"example.com/app"}},
+		{"small", true, "example.com/app", "golang.org/x/text@v0.3.0", []string{"example.com/app", "example.com/a@v1.0.0", "example.com/c@v1.2.0", "golang.org/x/text@v0.3.0"}},
+		{"small", false, "example.com/c", "example.com/a", nil},
+		{"small", false, "example.com/unknown", "example.com/a", nil},
+		{"cyclic", false, "example.com/z", "example.com/w", []string{"example.com/z", "example.com/x", "example.com/w"}},
+		{"cyclic", false, "example.com/z", "example.com/y", []string{"example.com/z", "example.com/app", "example.com/y"}},
+		{"cyclic", true, "example.com/app", "example.com/w@v1.0.0", []string{"example.com/app", "example.com/y@v1.0.0", "example.com/z@v1.0.0", "example.com/app@v0.9.0", "example.com/x@v0.5.0", "example.com/w@v1.0.0"}},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		gr, _ := fx.graph(t, tc.versioned)
+		if got, want := gr.shortestPath(tc.from, tc.to), tc.path; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: %v -> %v: got %v, want %v", tc.fixture, tc.from, tc.to, got, want)
+		}
+	}
+}
+
+func TestFakeGoDeprecated(t *testing.T) {
+	fixture := t.TempDir()
+	writeFiles(t, fixture, map[string]string{
+		"go.mod": `// Deprecated: use example.com/new instead.
+module example.com/app
+
+require (
+	example.com/a v1.0.0
+	example.com/b v1.0.0
+)
+`,
+		"modcache/cache/download/example.com/a/@v/v1.0.0.mod": "module example.com/a\n",
+		"modcache/cache/download/example.com/a/@v/v1.1.0.mod": "module example.com/a\n\n// broken.\nretract v1.0.0\n",
+		"modcache/cache/download/example.com/b/@v/v1.0.0.mod": "// Deprecated: unmaintained.\nmodule example.com/b\n",
+	})
+	out, err := runGodep(t, fixture, "graph", "deprecated", "--dir="+fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out, `example.com/a@v1.0.0
+  retracted: broken.
+  path: example.com/app -> example.com/a
+example.com/app
+  deprecated: use example.com/new instead.
+example.com/b@v1.0.0
+  deprecated: unmaintained.
+  path: example.com/app -> example.com/b
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+func init() {
+	must(pflagvar.RegisterFlagsInStruct(graphCmd.PersistentFlags(), "parse", &graphState, nil, nil))
+}
+
+// diagnostics records the problems found in the output of go mod graph:
+// malformed lines, which are ignored, and dependencies on modules that
+// are otherwise unknown, which are added to the graph. With --strict
+// either is an error instead. Errors loading packages reported by
+// go list -e, which may mean that the modules they import are missing,
+// and go.mod files that cannot be parsed, which are ignored, are also
+// recorded.
+type diagnostics struct {
+	Malformed     []*lineError `json:"malformed,omitempty"`
+	Unrecognised  []string     `json:"unrecognised,omitempty"`
+	PackageErrors []string     `json:"package_errors,omitempty"`
+	InvalidGoMods []string     `json:"invalid_gomods,omitempty"`
+}
+
+// moduleDiagnostics records the problems found in the output of
+// go mod graph, and go list, for the current module. It is reset before
+// each command is run and its malformed lines are replaced, rather than
+// appended to, each time go mod graph is rerun since the output is
+// unchanged. Snapshots of other module configurations, eg. those created
+// by upgrade-impact and history, record their own diagnostics.
+var moduleDiagnostics = &diagnostics{}
+
+// maxSummaryLines is the maximum number of problems of each kind that are
+// displayed in the summary.
+const maxSummaryLines = 5
+
+func (d *diagnostics) empty() bool {
+	return len(d.Malformed) == 0 && len(d.Unrecognised) == 0 && len(d.PackageErrors) == 0 && len(d.InvalidGoMods) == 0
+}
+
+// orNil returns nil if there are no diagnostics so that they can be
+// omitted from json output.
+func (d *diagnostics) orNil() *diagnostics {
+	if d.empty() {
+		return nil
+	}
+	return d
+}
+
+func (d *diagnostics) addUnrecognised(module string) {
+	for _, m := range d.Unrecognised {
+		if m == module {
+			return
+		}
+	}
+	d.Unrecognised = append(d.Unrecognised, module)
+}
+
+func (d *diagnostics) addPackageError(msg string) {
+	for _, e := range d.PackageErrors {
+		if e == msg {
+			return
+		}
+	}
+	d.PackageErrors = append(d.PackageErrors, msg)
+}
+
+func (d *diagnostics) addInvalidGoMod(msg string) {
+	for _, e := range d.InvalidGoMods {
+		if e == msg {
+			return
+		}
+	}
+	d.InvalidGoMods = append(d.InvalidGoMods, msg)
+}
+
+func summarize(out io.Writer, items []string) {
+	for i, item := range items {
+		if i == maxSummaryLines {
+			fmt.Fprintf(out, "  ... and %v more\n", len(items)-i)
+			break
+		}
+		fmt.Fprintf(out, "  %v\n", item)
+	}
+}
+
+// summary writes a summary of the diagnostics, if any, to out.
+func (d *diagnostics) summary(out io.Writer) {
+	if n := len(d.Malformed); n > 0 {
+		fmt.Fprintf(out, "warning: ignored %v malformed line(s) in the output of go mod graph, use --strict to fail instead:\n", n)
+		lines := make([]string, len(d.Malformed))
+		for i, le := range d.Malformed {
+			lines[i] = le.Error()
+		}
+		summarize(out, lines)
+	}
+	if n := len(d.Unrecognised); n > 0 {
+		fmt.Fprintf(out, "warning: added %v unrecognised module(s) to the graph, use --strict to fail instead:\n", n)
+		summarize(out, d.Unrecognised)
+	}
+	if n := len(d.PackageErrors); n > 0 {
+		fmt.Fprintf(out, "warning: go list reported %v package error(s), the modules they import may be missing:\n", n)
+		summarize(out, d.PackageErrors)
+	}
+	if n := len(d.InvalidGoMods); n > 0 {
+		fmt.Fprintf(out, "warning: ignored %v go.mod file(s) that could not be parsed, their requirements are not marked as indirect:\n", n)
+		summarize(out, d.InvalidGoMods)
+	}
+}
+
+// malformedError returns an error that lists all of the malformed lines.
+func malformedError(malformed []*lineError) error {
+	lines := make([]string, len(malformed))
+	for i, le := range malformed {
+		lines[i] = "  " + le.Error()
+	}
+	return fmt.Errorf("%v malformed line(s) in the output of go mod graph:\n%v", len(malformed), strings.Join(lines, "\n"))
+}
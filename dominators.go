@@ -0,0 +1,175 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphDominatorsCmd = &cobra.Command{
+	Use:   "dominators",
+	Short: "display the number of modules that are only required because of each module",
+	Long: `display the dominator tree of the dependency graph, starting at the root.
+A module dominates another if every path from the root to that other module
+passes through it, that is, the dominated module is only required because
+of the dominating one. Removing a module removes all of the modules that it
+dominates and hence the modules that dominate the most others are the
+highest leverage ones to remove.`,
+	RunE: graphDominators,
+}
+
+func init() {
+	graphCmd.AddCommand(graphDominatorsCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphDominatorsCmd.Flags(), "graph", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(graphDominatorsCmd.Flags(), "dominators", &graphState, nil, nil))
+}
+
+// dominatorTree records the immediate dominator of each module reachable
+// from the root and the number of modules that each module dominates.
+type dominatorTree struct {
+	root      string
+	idom      map[string]string
+	children  map[string][]string
+	dominated map[string]int // excluding the module itself.
+}
+
+// dominatorTree computes the dominator tree rooted at root using the
+// iterative algorithm described in 'A Simple, Fast Dominance Algorithm'
+// by Cooper, Harvey and Kennedy.
+func (gr *graph) dominatorTree(root string) *dominatorTree {
+	// Number the nodes in postorder, the root has the highest number.
+	postorder := []*graphNode{}
+	index := map[string]int{}
+	var visit func(gn *graphNode)
+	visit = func(gn *graphNode) {
+		index[gn.module] = -1
+		deps := append([]*graphNode{}, gn.dependencies...)
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].module < deps[j].module
+		})
+		for _, dep := range deps {
+			if _, ok := index[dep.module]; !ok {
+				visit(dep)
+			}
+		}
+		index[gn.module] = len(postorder)
+		postorder = append(postorder, gn)
+	}
+	dt := &dominatorTree{
+		root:      root,
+		idom:      map[string]string{},
+		children:  map[string][]string{},
+		dominated: map[string]int{},
+	}
+	if gr.nodes[root] == nil {
+		return dt
+	}
+	visit(gr.nodes[root])
+
+	n := len(postorder)
+	idom := make([]int, n)
+	for i := range idom {
+		idom[i] = -1
+	}
+	idom[n-1] = n - 1
+	intersect := func(a, b int) int {
+		for a != b {
+			for a < b {
+				a = idom[a]
+			}
+			for b < a {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		// Process the nodes in reverse postorder, skipping the root.
+		for i := n - 2; i >= 0; i-- {
+			candidate := -1
+			for _, p := range postorder[i].dependents {
+				pi, ok := index[p.module]
+				if !ok || idom[pi] == -1 {
+					continue
+				}
+				if candidate == -1 {
+					candidate = pi
+					continue
+				}
+				candidate = intersect(pi, candidate)
+			}
+			if idom[i] != candidate {
+				idom[i] = candidate
+				changed = true
+			}
+		}
+	}
+
+	// A node's immediate dominator always follows it in postorder and
+	// hence the sizes of the subtrees can be accumulated in a single pass.
+	size := make([]int, n)
+	for i := 0; i < n-1; i++ {
+		size[i]++
+		size[idom[i]] += size[i]
+		m, d := postorder[i].module, postorder[idom[i]].module
+		dt.idom[m] = d
+		dt.children[d] = append(dt.children[d], m)
+	}
+	size[n-1]++
+	for i, gn := range postorder {
+		dt.dominated[gn.module] = size[i] - 1
+	}
+	return dt
+}
+
+// tree returns the dominator tree with each module annotated with the
+// number of modules that it dominates.
+func (dt *dominatorTree) tree(module string) *treeNode {
+	tn := &treeNode{
+		Module:   fmt.Sprintf("%v (%v)", module, dt.dominated[module]),
+		Children: map[string]*treeNode{},
+	}
+	for _, c := range dt.children[module] {
+		tn.Children[c] = dt.tree(c)
+	}
+	return tn
+}
+
+func graphDominators(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	graph, root, _, err := loadQueryGraph(ctx, "", graphState.Versioned)
+	if err != nil {
+		return err
+	}
+	dt := graph.dominatorTree(root)
+	if graphState.DominatorTree {
+		dt.tree(root).print(cmd.OutOrStdout(), 0)
+		return nil
+	}
+	modules := make([]string, 0, len(dt.idom))
+	for m := range dt.idom {
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		a, b := dt.dominated[modules[i]], dt.dominated[modules[j]]
+		if a == b {
+			return modules[i] < modules[j]
+		}
+		return a > b
+	})
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "module\tdominated\timmediate dominator\n")
+	for _, m := range modules {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", m, dt.dominated[m], dt.idom[m])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDominatorTree(t *testing.T) {
+	for _, tc := range []struct {
+		fixture   string
+		versioned bool
+		idom      map[string]string
+		dominated map[string]int
+	}{
+		{"small", false,
+			map[string]string{
+				"example.com/a":     "example.com/app",
+				"example.com/b":     "example.com/app",
+				"example.com/c":     "example.com/app",
+				"golang.org/x/text": "example.com/app",
+			},
+			map[string]int{
+				"example.com/app":   4,
+				"example.com/a":     0,
+				"example.com/b":     0,
+				"example.com/c":     0,
+				"golang.org/x/text": 0,
+			}},
+		{"small", true,
+			map[string]string{
+				"example.com/a@v1.0.0":     "example.com/app",
+				"example.com/b@v1.1.0":     "example.com/app",
+				"example.com/c@v1.3.0":     "example.com/app",
+				"example.com/c@v1.2.0":     "example.com/a@v1.0.0",
+				"golang.org/x/text@v0.3.7": "example.com/app",
+				"golang.org/x/text@v0.3.0": "example.com/c@v1.2.0",
+			},
+			map[string]int{
+				"example.com/app":          6,
+				"example.com/a@v1.0.0":     2,
+				"example.com/b@v1.1.0":     0,
+				"example.com/c@v1.3.0":     0,
+				"example.com/c@v1.2.0":     1,
+				"golang.org/x/text@v0.3.7": 0,
+				"golang.org/x/text@v0.3.0": 0,
+			}},
+		// The cycle back to the root does not change its dominators.
+		{"cyclic", false,
+			map[string]string{
+				"example.com/x": "example.com/app",
+				"example.com/y": "example.com/app",
+				"example.com/z": "example.com/y",
+				"example.com/w": "example.com/x",
+			},
+			map[string]int{
+				"example.com/app": 4,
+				"example.com/x":   1,
+				"example.com/y":   1,
+				"example.com/z":   0,
+				"example.com/w":   0,
+			}},
+		{"cyclic", true,
+			map[string]string{
+				"example.com/x@v1.0.0":   "example.com/app",
+				"example.com/y@v1.0.0":   "example.com/app",
+				"example.com/z@v1.0.0":   "example.com/y@v1.0.0",
+				"example.com/app@v0.9.0": "example.com/z@v1.0.0",
+				"example.com/x@v0.5.0":   "example.com/app@v0.9.0",
+				"example.com/w@v1.0.0":   "example.com/x@v0.5.0",
+			},
+			map[string]int{
+				"example.com/app":        6,
+				"example.com/x@v1.0.0":   0,
+				"example.com/y@v1.0.0":   4,
+				"example.com/z@v1.0.0":   3,
+				"example.com/app@v0.9.0": 2,
+				"example.com/x@v0.5.0":   1,
+				"example.com/w@v1.0.0":   0,
+			}},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		gr, _ := fx.graph(t, tc.versioned)
+		dt := gr.dominatorTree(fx.root)
+		if got, want := dt.idom, tc.idom; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: versioned %v: got %v, want %v", tc.fixture, tc.versioned, got, want)
+		}
+		if got, want := dt.dominated, tc.dominated; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: versioned %v: got %v, want %v", tc.fixture, tc.versioned, got, want)
+		}
+	}
+
+	fx := loadFixture(t, "cyclic")
+	gr, _ := fx.graph(t, false)
+	out := &bytes.Buffer{}
+	gr.dominatorTree(fx.root).tree(fx.root).print(out, 0)
+	if got, want := out.String(), `example.com/app (4)
+  example.com/x (1)
+    example.com/w (0)
+  example.com/y (1)
+    example.com/z (0)
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// An unknown root yields an empty tree.
+	if got, want := len(gr.dominatorTree("example.com/unknown").idom), 0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
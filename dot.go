@@ -0,0 +1,208 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphDotCmd = &cobra.Command{
+	Use:   "dot",
+	Short: "output dependency graph in dot format",
+	Long: `output dependency graph in dot format. Modules are colored by group if
+--group-by is specified and modules that are not selected by minimal version
+selection are displayed in gray. Edges for requirements that are only
+ever marked as // indirect are dashed, as are those, in blue, for modules that
+are only imported by tests if --classify is specified.
+
+A custom template may be specified using --template, it is executed with
+the annotatedGraph type defined in annotate.go. Its Nodes include the root
+module and node versions are only set if --versioned, --metadata or --classify
+is specified. The escape function quotes text for use within a dot string.`,
+	RunE: graphDot,
+}
+
+func init() {
+	graphCmd.AddCommand(graphDotCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphDotCmd.Flags(), "graph", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(graphDotCmd.Flags(), "dot", &graphState, nil, nil))
+}
+
+// dotFuncs are the functions available to the dot template, including
+// any custom template.
+var dotFuncs = template.FuncMap{
+	"escape": dotEscaper.Replace,
+}
+
+var graphDotTpl = template.Must(template.New("dot").Funcs(dotFuncs).Parse(`
+digraph {
+	graph [overlap=false, size=14{{with .RankDir}}, rankdir={{.}}{{end}}{{with .Layout}}, layout={{.}}{{end}}];
+	root="{{.Root}}";
+	node [  shape = plaintext, fontname = "Helvetica", fontsize=24];
+	"{{.Root}}" [style = filled, fillcolor = "#E94762"];
+{{range .Nodes}}{{if .Root}}{{else if .Color}}	"{{.Module}}" [style = filled, fillcolor = "{{.Color}}"{{if not .Selected}}, fontcolor = "#999999"{{end}}];
+{{else if not .Selected}}	"{{.Module}}" [fontcolor = "#999999"];
+{{end}}{{end}}{{range .Nodes}}{{if .Metadata}}	"{{.Module}}" [tooltip = "{{.Description}}"{{if .Deprecated}}, fontcolor = "#D62728"{{end}}];
+{{end}}{{end}}{{range .Clusters}}	subgraph cluster_{{.Index}} {
+		label = "{{escape .Name}}";
+{{range .Modules}}		"{{.}}";
+{{end}}	}
+{{end}}{{range .Dependencies}}"{{.Module}}" -> "{{.DependsOn}}"{{if or .Label .Indirect .TestOnly}} [{{with .Label}}label = "{{.}}"{{end}}{{if or .Indirect .TestOnly}}{{if .Label}}, {{end}}style = dashed{{end}}{{if .TestOnly}}, color = "#1F77B4"{{end}}]{{end}}
+{{end}}{{if .Legend}}	subgraph cluster_legend {
+		label = "legend";
+		node [fontsize=14];
+		"legend: root" [label = "root module", style = filled, fillcolor = "#E94762"];
+		"legend: pruned" [label = "not selected", fontcolor = "#999999"];
+{{if .Metadata}}		"legend: deprecated" [label = "deprecated or retracted", fontcolor = "#D62728"];
+{{end}}{{range $i, $g := .Groups}}		"legend: group {{$i}}" [label = "{{escape $g.Name}}", style = filled, fillcolor = "{{$g.Color}}"];
+{{end}}		"legend: a" [label = "module"];
+		"legend: b" [label = "dependency"];
+		"legend: c" [label = "indirect dependency"];
+		"legend: a" -> "legend: b" [label = "direct"];
+		"legend: a" -> "legend: c" [label = "indirect", style = dashed];
+{{if .Usage}}		"legend: d" [label = "test only dependency"];
+		"legend: a" -> "legend: d" [label = "test only", style = dashed, color = "#1F77B4"];
+{{end}}	}
+{{end}}
+}
+`))
+
+func graphDot(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	tpl := graphDotTpl
+	if len(graphState.DotTemplate) > 0 {
+		buf, err := ioutil.ReadFile(graphState.DotTemplate)
+		if err != nil {
+			return err
+		}
+		if tpl, err = template.New("dot").Funcs(dotFuncs).Parse(string(buf)); err != nil {
+			return fmt.Errorf("failed to parse template %v: %v", graphState.DotTemplate, err)
+		}
+	}
+	// The requirements are only loaded if the template uses them, the
+	// edge labels are created from the required versions.
+	fields := []string{"Indirect", "Versions"}
+	if graphState.DotLabels {
+		fields = append(fields, "Label")
+	}
+	graph, err := loadAnnotatedGraph(ctx, false, templateUses(tpl, fields...))
+	if err != nil {
+		return err
+	}
+	graph.RankDir = graphState.DotRankDir
+	graph.Layout = graphState.DotLayout
+	graph.Legend = graphState.DotLegend
+	if graphState.DotLabels {
+		for i, dep := range graph.Dependencies {
+			graph.Dependencies[i].Label = strings.Join(dep.Versions, ",")
+		}
+	}
+	format := graphState.DotFormat
+	if len(format) == 0 {
+		// output raw dot format
+		return tpl.Execute(cmd.OutOrStdout(), graph)
+	}
+
+	writeDotFile := func() (string, error) {
+		tmpfile, err := ioutil.TempFile("", "dot-*.dot")
+		if err != nil {
+			return "", err
+		}
+		defer tmpfile.Close()
+		if err := tpl.Execute(tmpfile, graph); err != nil {
+			os.Remove(tmpfile.Name())
+			return tmpfile.Name(), err
+		}
+		return tmpfile.Name(), nil
+	}
+	name, err := writeDotFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(name)
+	dotcmd := exec.CommandContext(ctx, graphState.DotCommand, "-T"+format, name)
+	dotcmd.Stdout = cmd.OutOrStdout()
+	return dotcmd.Run()
+}
+
+// templateUses returns true if any of the templates associated with tpl
+// refer to any of the named fields or methods, eg. Indirect for either
+// .Indirect or $edge.Indirect.
+func templateUses(tpl *template.Template, names ...string) bool {
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = true
+	}
+	uses := func(idents []string) bool {
+		for _, id := range idents {
+			if want[id] {
+				return true
+			}
+		}
+		return false
+	}
+	var walk func(node parse.Node) bool
+	walk = func(node parse.Node) bool {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return false
+			}
+			for _, c := range n.Nodes {
+				if walk(c) {
+					return true
+				}
+			}
+		case *parse.ActionNode:
+			return walk(n.Pipe)
+		case *parse.IfNode:
+			return walk(n.Pipe) || walk(n.List) || walk(n.ElseList)
+		case *parse.RangeNode:
+			return walk(n.Pipe) || walk(n.List) || walk(n.ElseList)
+		case *parse.WithNode:
+			return walk(n.Pipe) || walk(n.List) || walk(n.ElseList)
+		case *parse.TemplateNode:
+			return walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return false
+			}
+			for _, c := range n.Cmds {
+				if walk(c) {
+					return true
+				}
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				if walk(a) {
+					return true
+				}
+			}
+		case *parse.FieldNode:
+			return uses(n.Ident)
+		case *parse.VariableNode:
+			return uses(n.Ident[1:])
+		case *parse.ChainNode:
+			return walk(n.Node) || uses(n.Field)
+		}
+		return false
+	}
+	for _, t := range tpl.Templates() {
+		if t.Tree != nil && walk(t.Tree.Root) {
+			return true
+		}
+	}
+	return false
+}
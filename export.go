@@ -0,0 +1,462 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the dependency graph in graphml, gexf, mermaid, cypher, csv or jsonl formats",
+	Long: `export the dependency graph, including module versions, groups, selection
+status and whether requirements are indirect, in one of the following formats:
+
+  graphml  - for use with yEd and other graphml tools
+  gexf     - for use with Gephi
+  mermaid  - for use in markdown documentation
+  cypher   - statements to create the graph in Neo4j
+  csv      - a table of either the nodes or edges, see --csv-table
+  jsonl    - one json object per line for each node and edge`,
+	RunE: graphExport,
+}
+
+func init() {
+	graphCmd.AddCommand(graphExportCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphExportCmd.Flags(), "graph", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(graphExportCmd.Flags(), "export", &graphState, nil, nil))
+}
+
+var exporters = map[string]func(out io.Writer, graph *annotatedGraph) error{
+	"graphml": exportGraphML,
+	"gexf":    exportGEXF,
+	"mermaid": exportMermaid,
+	"cypher":  exportCypher,
+	"csv":     exportCSV,
+	"jsonl":   exportJSONL,
+}
+
+func graphExport(cmd *cobra.Command, args []string) error {
+	export, ok := exporters[graphState.ExportFormat]
+	if !ok {
+		return fmt.Errorf("unsupported export format: %v", graphState.ExportFormat)
+	}
+	ctx := context.Background()
+	graph, err := loadAnnotatedGraph(ctx, true, true)
+	if err != nil {
+		return err
+	}
+	return export(cmd.OutOrStdout(), graph)
+}
+
+// metadataAttributes are the node attributes written for module metadata
+// when --metadata is specified. Types are valid for both graphml and gexf.
+var metadataAttributes = []struct {
+	name, typ string
+	value     func(md *moduleMetadata) string
+}{
+	{"go_version", "string", func(md *moduleMetadata) string { return md.GoVersion }},
+	{"released", "string", func(md *moduleMetadata) string {
+		if md.Time.IsZero() {
+			return ""
+		}
+		return md.Time.Format(time.RFC3339)
+	}},
+	{"deprecated", "string", func(md *moduleMetadata) string { return md.Deprecated }},
+	{"retracted", "boolean", func(md *moduleMetadata) string { return strconv.FormatBool(md.Retracted) }},
+	{"rationale", "string", func(md *moduleMetadata) string { return md.Rationale }},
+	{"packages", "long", func(md *moduleMetadata) string { return strconv.Itoa(md.Packages) }},
+	{"size", "long", func(md *moduleMetadata) string { return strconv.FormatInt(md.Size, 10) }},
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+func writeXML(out io.Writer, v interface{}) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+func exportGraphML(out io.Writer, graph *annotatedGraph) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "version", For: "node", Name: "version", Type: "string"},
+			{ID: "group", For: "node", Name: "group", Type: "string"},
+			{ID: "root", For: "node", Name: "root", Type: "boolean"},
+			{ID: "selected", For: "node", Name: "selected", Type: "boolean"},
+			{ID: "versions", For: "edge", Name: "versions", Type: "string"},
+			{ID: "indirect", For: "edge", Name: "indirect", Type: "boolean"},
+		},
+	}
+	if graphState.Metadata {
+		for _, attr := range metadataAttributes {
+			doc.Keys = append(doc.Keys, graphMLKey{ID: attr.name, For: "node", Name: attr.name, Type: attr.typ})
+		}
+	}
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range graph.Nodes {
+		node := graphMLNode{
+			ID: n.Module,
+			Data: []graphMLData{
+				{Key: "label", Value: n.Module},
+				{Key: "version", Value: n.Version},
+				{Key: "group", Value: n.Group},
+				{Key: "root", Value: strconv.FormatBool(n.Root)},
+				{Key: "selected", Value: strconv.FormatBool(n.Selected)},
+			},
+		}
+		if n.Metadata != nil {
+			for _, attr := range metadataAttributes {
+				node.Data = append(node.Data, graphMLData{Key: attr.name, Value: attr.value(n.Metadata)})
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range graph.Dependencies {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.Module,
+			Target: e.DependsOn,
+			Data: []graphMLData{
+				{Key: "versions", Value: strings.Join(e.Versions, " ")},
+				{Key: "indirect", Value: strconv.FormatBool(e.Indirect)},
+			},
+		})
+	}
+	return writeXML(out, &doc)
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        int            `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexf struct {
+	XMLName xml.Name `xml:"gexf"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Version string   `xml:"version,attr"`
+	Graph   struct {
+		DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+		Attributes      []gexfAttributes `xml:"attributes"`
+		Nodes           []gexfNode       `xml:"nodes>node"`
+		Edges           []gexfEdge       `xml:"edges>edge"`
+	} `xml:"graph"`
+}
+
+func exportGEXF(out io.Writer, graph *annotatedGraph) error {
+	doc := gexf{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+	}
+	doc.Graph.DefaultEdgeType = "directed"
+	doc.Graph.Attributes = []gexfAttributes{
+		{Class: "node", Attributes: []gexfAttribute{
+			{ID: "version", Title: "version", Type: "string"},
+			{ID: "group", Title: "group", Type: "string"},
+			{ID: "root", Title: "root", Type: "boolean"},
+			{ID: "selected", Title: "selected", Type: "boolean"},
+		}},
+		{Class: "edge", Attributes: []gexfAttribute{
+			{ID: "versions", Title: "versions", Type: "string"},
+			{ID: "indirect", Title: "indirect", Type: "boolean"},
+		}},
+	}
+	if graphState.Metadata {
+		for _, attr := range metadataAttributes {
+			doc.Graph.Attributes[0].Attributes = append(doc.Graph.Attributes[0].Attributes, gexfAttribute{ID: attr.name, Title: attr.name, Type: attr.typ})
+		}
+	}
+	for _, n := range graph.Nodes {
+		node := gexfNode{
+			ID:    n.Module,
+			Label: n.Module,
+			AttValues: []gexfAttValue{
+				{For: "version", Value: n.Version},
+				{For: "group", Value: n.Group},
+				{For: "root", Value: strconv.FormatBool(n.Root)},
+				{For: "selected", Value: strconv.FormatBool(n.Selected)},
+			},
+		}
+		if n.Metadata != nil {
+			for _, attr := range metadataAttributes {
+				node.AttValues = append(node.AttValues, gexfAttValue{For: attr.name, Value: attr.value(n.Metadata)})
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for i, e := range graph.Dependencies {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     i,
+			Source: e.Module,
+			Target: e.DependsOn,
+			AttValues: []gexfAttValue{
+				{For: "versions", Value: strings.Join(e.Versions, " ")},
+				{For: "indirect", Value: strconv.FormatBool(e.Indirect)},
+			},
+		})
+	}
+	return writeXML(out, &doc)
+}
+
+// exportMermaid writes a mermaid flowchart, node ids are generated since
+// module paths contain characters that mermaid does not allow in ids.
+func exportMermaid(out io.Writer, graph *annotatedGraph) error {
+	var b strings.Builder
+	ids := make(map[string]string, len(graph.Nodes))
+	b.WriteString("graph TD\n")
+	for i, n := range graph.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.Module] = id
+		fmt.Fprintf(&b, "    %v[\"%v\"]\n", id, strings.Replace(n.Module, `"`, "#quot;", -1))
+	}
+	for _, e := range graph.Dependencies {
+		arrow := "-->"
+		if e.Indirect {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "    %v %v %v\n", ids[e.Module], arrow, ids[e.DependsOn])
+	}
+	for _, n := range graph.Nodes {
+		if n.Root {
+			fmt.Fprintf(&b, "    style %v fill:#E94762\n", ids[n.Module])
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// cypherQuote returns s as a single quoted cypher string literal. Cypher
+// only supports the \t, \b, \n, \r, \f, \', \" and \\ escapes and
+// \uXXXX, which is used for all other control characters, unlike
+// strconv.Quote which also generates \a, \v, \xXX and \UXXXXXXXX.
+func cypherQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// exportCypher writes Neo4j cypher statements that create a Module node
+// for each module and a DEPENDS_ON relationship for each dependency.
+func exportCypher(out io.Writer, graph *annotatedGraph) error {
+	var b strings.Builder
+	for _, n := range graph.Nodes {
+		fmt.Fprintf(&b, "CREATE (:Module {path: %v, version: %v, group: %v, root: %v, selected: %v",
+			cypherQuote(n.Module), cypherQuote(n.Version), cypherQuote(n.Group), n.Root, n.Selected)
+		if n.Metadata != nil {
+			for _, attr := range metadataAttributes {
+				v := attr.value(n.Metadata)
+				if attr.typ == "string" {
+					v = cypherQuote(v)
+				}
+				fmt.Fprintf(&b, ", %v: %v", attr.name, v)
+			}
+		}
+		b.WriteString("});\n")
+	}
+	for _, e := range graph.Dependencies {
+		versions := make([]string, len(e.Versions))
+		for i, v := range e.Versions {
+			versions[i] = cypherQuote(v)
+		}
+		fmt.Fprintf(&b, "MATCH (a:Module {path: %v}), (b:Module {path: %v}) CREATE (a)-[:DEPENDS_ON {versions: [%v], indirect: %v}]->(b);\n",
+			cypherQuote(e.Module), cypherQuote(e.DependsOn), strings.Join(versions, ", "), e.Indirect)
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func exportCSV(out io.Writer, graph *annotatedGraph) error {
+	wr := csv.NewWriter(out)
+	switch graphState.ExportCSVTable {
+	case "nodes":
+		header := []string{"module", "version", "group", "root", "selected"}
+		if graphState.Metadata {
+			for _, attr := range metadataAttributes {
+				header = append(header, attr.name)
+			}
+		}
+		wr.Write(header)
+		for _, n := range graph.Nodes {
+			row := []string{n.Module, n.Version, n.Group, strconv.FormatBool(n.Root), strconv.FormatBool(n.Selected)}
+			for _, attr := range metadataAttributes {
+				if !graphState.Metadata {
+					break
+				}
+				value := ""
+				if n.Metadata != nil {
+					value = attr.value(n.Metadata)
+				}
+				row = append(row, value)
+			}
+			wr.Write(row)
+		}
+	case "edges":
+		wr.Write([]string{"module", "depends_on", "versions", "indirect"})
+		for _, e := range graph.Dependencies {
+			wr.Write([]string{e.Module, e.DependsOn, strings.Join(e.Versions, " "), strconv.FormatBool(e.Indirect)})
+		}
+	default:
+		return fmt.Errorf("unsupported csv table: %v, use nodes or edges", graphState.ExportCSVTable)
+	}
+	wr.Flush()
+	return wr.Error()
+}
+
+type jsonlNode struct {
+	Type     string          `json:"type"`
+	Module   string          `json:"module"`
+	Version  string          `json:"version,omitempty"`
+	Group    string          `json:"group,omitempty"`
+	Root     bool            `json:"root,omitempty"`
+	Selected bool            `json:"selected"`
+	Metadata *moduleMetadata `json:"metadata,omitempty"`
+}
+
+type jsonlEdge struct {
+	Type      string   `json:"type"`
+	Module    string   `json:"module"`
+	DependsOn string   `json:"depends_on"`
+	Versions  []string `json:"versions,omitempty"`
+	Indirect  bool     `json:"indirect"`
+}
+
+// jsonlDiagnostics is written as the last line if any problems were
+// found in the output of go mod graph.
+type jsonlDiagnostics struct {
+	Type string `json:"type"`
+	*diagnostics
+}
+
+func exportJSONL(out io.Writer, graph *annotatedGraph) error {
+	enc := json.NewEncoder(out)
+	for _, n := range graph.Nodes {
+		if err := enc.Encode(jsonlNode{
+			Type:     "node",
+			Module:   n.Module,
+			Version:  n.Version,
+			Group:    n.Group,
+			Root:     n.Root,
+			Selected: n.Selected,
+			Metadata: n.Metadata,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, e := range graph.Dependencies {
+		if err := enc.Encode(jsonlEdge{
+			Type:      "edge",
+			Module:    e.Module,
+			DependsOn: e.DependsOn,
+			Versions:  e.Versions,
+			Indirect:  e.Indirect,
+		}); err != nil {
+			return err
+		}
+	}
+	if d := moduleDiagnostics.orNil(); d != nil {
+		return enc.Encode(jsonlDiagnostics{Type: "diagnostics", diagnostics: d})
+	}
+	return nil
+}
@@ -0,0 +1,615 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// fakeGoScript serves canned output for the go commands run by gomodgraph
+// from a testdata fixture. Unsupported commands fail, as does go mod graph
+// if the fixture contains a modgraph.err file. The modules for package
+// loading, go list -e -deps, are read from deps-$GOOS-$GOARCH.txt, or
+// deps.txt if GOOS is not set, for ./..., from deps-test.txt if -test is
+// specified and from deps-tools.txt for any other packages. If FAKE_GO_LOG
+// is set, the directory, build context and arguments of each command are
+// appended to it. If the fixture has no modgraph.txt or list.txt file
+// the output of go mod graph and go list -m is derived from the
+// requirements in the go.mod file in the current directory. The go.mod
+// file reported by go list -m -json for each main module is
+// <base>/go.mod, where base is the last element of its path, if it
+// exists in the fixture and go.mod otherwise.
+const fakeGoScript = `#!/bin/sh
+fixture="%v"
+requirements() {
+	awk '$1 == "module" { print $2 }
+		$1 == "require" && $2 != "(" { print $2, $3 }
+		$1 == "require" && $2 == "(" { r = 1; next }
+		r && $1 == ")" { r = 0 }
+		r { print $1, $2 }' go.mod
+}
+if [ -n "$FAKE_GO_LOG" ]; then
+	echo "$PWD|$GOFLAGS|$GOWORK|$GOOS|$GOARCH|$*" >> "$FAKE_GO_LOG"
+fi
+case "$1 $2" in
+"mod graph")
+	if [ -f "$fixture/modgraph.err" ]; then
+		cat "$fixture/modgraph.err" >&2
+		exit 1
+	fi
+	if [ -f "$fixture/modgraph.txt" ]; then
+		cat "$fixture/modgraph.txt"
+	else
+		requirements | awk 'NR == 1 { m = $1; next } { print m, $1 "@" $2 }'
+	fi;;
+"list -m")
+	if [ -f "$fixture/list.txt" ]; then
+		list() { cat "$fixture/list.txt"; }
+	else
+		list() { requirements; }
+	fi
+	if [ "$3" = "all" ]; then
+		list
+	elif [ "$3" = "-json" ]; then
+		list | awk 'NF == 1 { print $1 }' | while read -r m; do
+			gomod="$fixture/${m##*/}/go.mod"
+			[ -f "$gomod" ] || gomod="$fixture/go.mod"
+			printf '{"Path": "%%s", "Main": true, "GoMod": "%%s"}\n' "$m" "$gomod"
+		done
+	else
+		list | head -n 1
+	fi;;
+"list -e")
+	for last; do :; done
+	if [ "$4" = "-test" ]; then
+		cat "$fixture/deps-test.txt"
+	elif [ "$last" = "./..." ]; then
+		cat "$fixture/deps${GOOS:+-$GOOS-$GOARCH}.txt"
+	else
+		cat "$fixture/deps-tools.txt"
+	fi;;
+"env -json")
+	printf '{"GOMODCACHE": "%%s", "GOMOD": "%%s", "GOVERSION": "fake", "GOWORK": "", "GOFLAGS": ""}\n' "$fixture/modcache" "$fixture/go.mod";;
+*)
+	echo "fake go: unsupported command: $*" >&2
+	exit 2;;
+esac
+`
+
+// fakeGo writes a fake go command for the named fixture, which may be in
+// testdata or an absolute path, and returns its path.
+func fakeGo(t *testing.T, fixture string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go command is a shell script")
+	}
+	if !filepath.IsAbs(fixture) {
+		fixture = filepath.Join("testdata", fixture)
+	}
+	fixture, err := filepath.Abs(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(t.TempDir(), "go")
+	if err := ioutil.WriteFile(script, []byte(fmt.Sprintf(fakeGoScript, fixture)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+// resetFlags restores the default values of all flags, and hence of
+// graphState, since cobra commands and their flags are package globals.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		f.Value.Set(f.DefValue)
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
+	}
+}
+
+// runGodep runs godep with the supplied arguments using a fake go command
+// for the fixture and returns its standard output.
+func runGodep(t *testing.T, fixture string, args ...string) (string, error) {
+	out, _, err := runGodepStderr(t, fixture, args...)
+	return out, err
+}
+
+// runGodepStderr is like runGodep but also returns the standard error.
+func runGodepStderr(t *testing.T, fixture string, args ...string) (string, string, error) {
+	resetFlags(rootCmd)
+	defaultGraphCache.initialized = false
+	args = append(args, "--go="+fakeGo(t, fixture))
+	if args[0] == "graph" {
+		args = append(args, "--no-cache")
+	}
+	rootCmd.SetArgs(args)
+	out, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(stderr)
+	err := rootCmd.Execute()
+	return out.String(), stderr.String(), err
+}
+
+func TestFakeGoCommands(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		args    []string
+		golden  string
+	}{
+		{"small", []string{"graph", "dot"}, "dot"},
+		{"cyclic", []string{"graph", "query"}, "query"},
+		{"versioned", []string{"graph", "query", "--versioned", "--contains=example.com/util@v0.1.0"}, "query-contains"},
+		{"huge", []string{"graph", "query", "--dependencies=false", "--start=golang.org/x/sys"}, "query-dependents"},
+		{"workspace", []string{"graph", "dot"}, "dot"},
+	} {
+		out, err := runGodep(t, tc.fixture, tc.args...)
+		if err != nil {
+			t.Errorf("%v %v: %v", tc.fixture, tc.args, err)
+			continue
+		}
+		compareGolden(t, tc.fixture, tc.golden, []byte(out))
+	}
+}
+
+// TestFakeGoSelectedVersions tests that go list -m all is only run for
+// dot and itree output if the selected versions are needed.
+func TestFakeGoSelectedVersions(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		list bool
+	}{
+		{[]string{"graph", "dot"}, false},
+		{[]string{"graph", "dot", "--edge-labels"}, false},
+		{[]string{"graph", "dot", "--versioned"}, true},
+		{[]string{"graph", "export", "--format=csv"}, true},
+		{[]string{"graph", "itree"}, true},
+		{[]string{"graph", "itree", "--versioned"}, false},
+		{[]string{"graph", "itree", "--versioned", "--metadata"}, false},
+		{[]string{"graph", "itree", "--versioned", "--classify"}, true},
+	} {
+		log := filepath.Join(t.TempDir(), "log")
+		t.Setenv("FAKE_GO_LOG", log)
+		if _, err := runGodep(t, "small", tc.args...); err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		buf, err := ioutil.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.Contains(string(buf), "|list -m all\n"), tc.list; got != want {
+			t.Errorf("%v: go list -m all run: got %v, want %v", tc.args, got, want)
+		}
+	}
+}
+
+// TestFakeGoRequirements tests that the go.mod files are only read for
+// dot output if the template uses the requirements and that those that
+// cannot be parsed are reported rather than failing the command.
+func TestFakeGoRequirements(t *testing.T) {
+	fixture := t.TempDir()
+	writeFiles(t, fixture, map[string]string{
+		"go.mod":       "module example.com/app\n\nrequire example.com/a v1.0.0\n",
+		"modgraph.txt": "example.com/app example.com/a@v1.0.0\nexample.com/a@v1.0.0 example.com/b@v1.0.0\n",
+		"modcache/cache/download/example.com/a/@v/v1.0.0.mod": "module example.com/a\n\nrequire (\n",
+		"edges.tpl": "{{range .Dependencies}}{{.Module}} {{.DependsOn}}\n{{end}}",
+	})
+	for _, tc := range []struct {
+		args []string
+		env  bool
+	}{
+		{[]string{"graph", "dot"}, true},
+		{[]string{"graph", "dot", "--template=" + filepath.Join(fixture, "edges.tpl")}, false},
+		{[]string{"graph", "dot", "--template=" + filepath.Join(fixture, "edges.tpl"), "--edge-labels"}, false},
+	} {
+		log := filepath.Join(t.TempDir(), "log")
+		t.Setenv("FAKE_GO_LOG", log)
+		out, stderr, err := runGodepStderr(t, fixture, append(tc.args, "--dir="+fixture)...)
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		if !strings.Contains(out, "example.com/b") {
+			t.Errorf("%v: got %v, want example.com/b", tc.args, out)
+		}
+		buf, err := ioutil.ReadFile(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.Contains(string(buf), "|env -json"), tc.env; got != want {
+			t.Errorf("%v: go env run: got %v, want %v", tc.args, got, want)
+		}
+		if got, want := strings.Contains(stderr, "1 go.mod file(s) that could not be parsed"), tc.env; got != want {
+			t.Errorf("%v: got %v, want a warning: %v", tc.args, stderr, want)
+		}
+	}
+	if got, want := templateUses(graphDotTpl, "Indirect"), true; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := templateUses(graphDotTpl, "Label"), true; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := templateUses(graphDotTpl, "Versions"), false; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFakeGoWheel(t *testing.T) {
+	out, err := runGodep(t, "small", "graph", "dependency-wheel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "small", "wheel.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The wheel golden file contains the module names, matrix and groups.
+	lines := strings.SplitN(string(golden), "\n", 2)
+	for _, want := range []string{lines[0], "<title>DependencyWheel for example.com/app</title>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q", want)
+		}
+	}
+}
+
+func TestFakeGoErrors(t *testing.T) {
+	dir := t.TempDir()
+	copyFixture := func(name string) string {
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range []string{"modgraph.txt", "list.txt"} {
+			in, err := os.Open(filepath.Join("testdata", "small", f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+			out, err := os.Create(filepath.Join(dst, f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.Copy(out, in); err != nil {
+				t.Fatal(err)
+			}
+			out.Close()
+		}
+		return dst
+	}
+
+	failing := copyFixture("failing")
+	msg := "go: updates to go.mod needed"
+	if err := ioutil.WriteFile(filepath.Join(failing, "modgraph.err"), []byte(msg+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"graph", "dot"},
+		{"graph", "query"},
+		{"graph", "dependency-wheel"},
+	} {
+		_, err := runGodep(t, failing, args...)
+		if err == nil || !strings.Contains(err.Error(), "failed to run `go mod graph`: "+msg) {
+			t.Errorf("%v: unexpected or missing error: %v", args, err)
+		}
+	}
+
+	malformed := copyFixture("malformed")
+	f, err := os.OpenFile(filepath.Join(malformed, "modgraph.txt"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(f, "example.com/app")
+	f.Close()
+	out, stderr, err := runGodepStderr(t, malformed, "graph", "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "small", "query.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out, string(golden); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := stderr, "warning: ignored 1 malformed line(s) in the output of go mod graph, use --strict to fail instead:\n  line 10: expected 2 space separated fields, found 1: \"example.com/app\"\n"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// The diagnostics are not carried over from one command to the next.
+	if _, stderr, _ = runGodepStderr(t, "small", "graph", "query"); len(stderr) > 0 {
+		t.Errorf("unexpected diagnostics: %v", stderr)
+	}
+	_, err = runGodep(t, malformed, "graph", "query", "--strict")
+	if err == nil || !strings.Contains(err.Error(), `line 10: expected 2 space separated fields, found 1: "example.com/app"`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+
+	if _, err := runGodep(t, "small", "graph", "upgrade-impact", "example.com/a@v1.1.0"); err == nil || !strings.Contains(err.Error(), "fake go: unsupported command") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+func TestFakeGoBadCommand(t *testing.T) {
+	resetFlags(rootCmd)
+	defer resetFlags(rootCmd)
+	graphState.GoCommand = filepath.Join(t.TempDir(), "no-such-go")
+	graphState.NoCache = true
+	if _, err := getRoot(context.Background(), goCmd{}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestFakeGoOutput(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "query.txt")
+	out, err := runGodep(t, "cyclic", "graph", "query", "--out="+filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) > 0 {
+		t.Errorf("unexpected output on stdout: %v", out)
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "cyclic", "query", buf)
+
+	// A failing command leaves an existing file untouched and no
+	// temporary files behind.
+	if _, err := runGodep(t, "small", "graph", "render", "--format=gif", "--out="+filename); err == nil {
+		t.Errorf("expected an error")
+	}
+	if got, err := ioutil.ReadFile(filename); err != nil || !bytes.Equal(got, buf) {
+		t.Errorf("%v was modified: %v", filename, err)
+	}
+	if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("unexpected files in %v: %v", dir, err)
+		for _, e := range entries {
+			t.Errorf("  %v", e.Name())
+		}
+	}
+
+	// render writes to --out, in the format given by its extension.
+	filename = filepath.Join(dir, "graph.svg")
+	if _, err := runGodep(t, "small", "graph", "render", "--group-by=org", "--out="+filename); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err = ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "small", "render.svg", buf)
+	os.Remove(filename)
+	if out, err = runGodep(t, "small", "graph", "render", "--format=png"); err != nil || !strings.HasPrefix(out, "\x89PNG") {
+		t.Errorf("not a png: %.10q: %v", out, err)
+	}
+
+	// --dir specifies the module to analyze, not the report directory.
+	module := filepath.Join(dir, "module")
+	if err := os.Mkdir(module, 0755); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report")
+	log := filepath.Join(dir, "log")
+	t.Setenv("FAKE_GO_LOG", log)
+	if _, err := runGodep(t, "small", "graph", "report", "--dir="+module, "--report-dir="+report); err != nil {
+		t.Fatal(err)
+	}
+	logged, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(logged), "|mod graph\n"), 1; got != want {
+		t.Errorf("go mod graph was run %v times, want %v", got, want)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(logged)), "\n") {
+		if !strings.HasPrefix(line, module+"|") {
+			t.Errorf("got %v, want prefix %v|", line, module)
+		}
+	}
+	if entries, err := ioutil.ReadDir(module); err != nil || len(entries) != 0 {
+		t.Errorf("report was written to the module directory: %v, %v", entries, err)
+	}
+	for _, rf := range append(reportFiles, reportFile{Name: "index.html"}) {
+		buf, err := ioutil.ReadFile(filepath.Join(report, rf.Name))
+		if err != nil {
+			t.Errorf("%v: %v", rf.Name, err)
+			continue
+		}
+		if !strings.Contains(string(buf), "example.com/app") {
+			t.Errorf("%v: does not mention the root module", rf.Name)
+		}
+	}
+}
+
+// TestFakeGoReportDiagnostics tests that the report's index page counts
+// the package errors reported when classifying modules.
+func TestFakeGoReportDiagnostics(t *testing.T) {
+	fixture := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{"go.mod", "list.txt", "modgraph.txt", "deps.txt", "deps-test.txt", "deps-tools.txt"} {
+		buf, err := ioutil.ReadFile(filepath.Join("testdata", "small", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(buf)
+	}
+	files["deps.txt"] += "error \"example.com/app/broken: no Go files\"\n"
+	writeFiles(t, fixture, files)
+	report := filepath.Join(fixture, "report")
+	if _, err := runGodep(t, fixture, "graph", "report", "--classify", "--dir="+fixture, "--report-dir="+report); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(report, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf), "0 unrecognised module(s), go list reported 1\npackage error(s)"; !strings.Contains(got, want) {
+		t.Errorf("got %v, want it to contain %v", got, want)
+	}
+}
+
+func TestFakeGoBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	t.Setenv("FAKE_GO_LOG", log)
+	t.Setenv("GOFLAGS", "-trimpath")
+	out, err := runGodep(t, "small", "graph", "query",
+		"--dir="+dir,
+		"--modfile=tools.mod",
+		"--goflags=-mod=mod",
+		"--tags=a,b",
+		"--gowork=off",
+		"--goos=windows",
+		"--goarch=arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "small", "query", []byte(out))
+	buf, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dir + "|-trimpath -mod=mod -modfile=" + filepath.Join(dir, "tools.mod") + " -tags=a,b|off|windows|arm64|"
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	for _, line := range lines {
+		if !strings.HasPrefix(line, want) {
+			t.Errorf("got %v, want prefix %v", line, want)
+		}
+	}
+	if got, want := lines[len(lines)-1], "mod graph"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %v, want suffix %v", got, want)
+	}
+}
+
+func TestFakeGoMatrix(t *testing.T) {
+	out, stderr, err := runGodepStderr(t, "small", "pkggraph", "matrix", "--targets=linux/amd64,windows/amd64,darwin/arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "small", "matrix", []byte(out))
+	if got, want := stderr, "warning: go list reported 1 package error(s), the modules they import may be missing:\n  windows/amd64: example.com/app/win: build constraints exclude all Go files in /src/win\n"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := runGodep(t, "small", "pkggraph", "matrix", "--targets=plan9/arm"); err == nil || !strings.Contains(err.Error(), "plan9/arm: failed to run `go list -e -deps") {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+func TestFakeGoUsage(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		golden string
+	}{
+		{[]string{"graph", "query", "--usage=test"}, "query-usage-test"},
+		{[]string{"graph", "query", "--usage=tool,unimported"}, "query-usage-tool"},
+		{[]string{"graph", "dot", "--classify", "--legend"}, "dot-classify"},
+	} {
+		out, err := runGodep(t, "small", tc.args...)
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		compareGolden(t, "small", tc.golden, []byte(out))
+	}
+	out, err := runGodep(t, "small", "graph", "itree", "--classify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"name": "example.com/b",`, `"usage": "tool"`, `"usage": "test"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q", want)
+		}
+	}
+	if _, err := runGodep(t, "small", "graph", "query", "--usage=benchmark"); err == nil || !strings.Contains(err.Error(), `invalid usage: "benchmark"`) {
+		t.Errorf("unexpected or missing error: %v", err)
+	}
+}
+
+func TestFakeGoHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	dir := t.TempDir()
+	git := func(date string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_AUTHOR_DATE="+date,
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_COMMITTER_DATE="+date,
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	commit := func(date, file, contents, msg string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git(date, "add", file)
+		git(date, "commit", "-q", "-m", msg)
+	}
+	git("2021-01-01T00:00:00Z", "init", "-q")
+	commit("2021-01-01T00:00:00Z", "go.mod", "module example.com/app\n\ngo 1.17\n\nrequire example.com/a v1.0.0\n", "initial")
+	commit("2021-02-01T00:00:00Z", "README.md", "app\n", "not a dependency change")
+	commit("2021-03-01T00:00:00Z", "go.mod", "module example.com/app\n\ngo 1.17\n\nrequire (\n\texample.com/a v1.0.0\n\texample.com/b v1.1.0\n\tgolang.org/x/text v0.3.7\n)\n", "add b")
+	commit("2021-04-01T00:00:00Z", "go.mod", "module example.com/app\n\ngo 1.17\n\nrequire (\n\texample.com/b v1.2.0\n\tgolang.org/x/text v0.3.7\n)\n", "drop a")
+	git("2021-04-01T00:00:00Z", "tag", "v1")
+	commit("2021-05-01T00:00:00Z", "go.mod", "module example.com/app\n\ngo 1.17\n\nrequire example.com/b v1.2.0\n", "drop text")
+
+	out, err := runGodep(t, dir, "graph", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "history", "history", []byte(out))
+
+	out, err = runGodep(t, dir, "graph", "history", "--every=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "history", "history-every", []byte(out))
+
+	out, err = runGodep(t, dir, "graph", "history", "--since=v1", "--format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var points []historyPoint
+	if err := json.Unmarshal([]byte(out), &points); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(points), 2; got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got, want := points[1].Removed, []string{"golang.org/x/text"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	out, err = runGodep(t, dir, "graph", "history", "--format=html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<title>Dependency history of example.com/app</title>", "<polyline", "drop text"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q", want)
+		}
+	}
+}
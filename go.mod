@@ -1,10 +1,18 @@
 module github.com/cosnicolaou/gomodgraph
 
-go 1.12
+go 1.18
 
 require (
-	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	github.com/spf13/cobra v1.7.0
-	github.com/spf13/viper v1.8.1 // indirect
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/image v0.18.0
+	golang.org/x/mod v0.20.0
+	gopkg.in/yaml.v2 v2.4.0
 	v.io/x/lib v0.1.14
 )
+
+require (
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/kr/pretty v0.1.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+)
@@ -0,0 +1,168 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+func init() {
+	must(pflagvar.RegisterFlagsInStruct(graphCmd.PersistentFlags(), "go", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(graphCmd.PersistentFlags(), "build", &graphState, nil, nil))
+}
+
+// goCmd runs the go command, as specified by --go, in Dir, or the
+// directory specified by --dir if Dir is empty, with the build context
+// specified by --modfile, --goflags, --tags, --gowork, --goos and --goarch
+// and then Env appended to the current environment.
+type goCmd struct {
+	Dir string
+	Env []string
+}
+
+// goCommand returns the go command to run.
+func goCommand() string {
+	if len(graphState.GoCommand) == 0 {
+		return "go"
+	}
+	return graphState.GoCommand
+}
+
+// modFile returns the absolute path of the file specified by --modfile,
+// or an empty string if it is not specified. A relative path is relative
+// to the directory specified by --dir, if any, since that is where the
+// go command is run.
+func modFile() string {
+	modfile := graphState.ModFile
+	if len(modfile) == 0 {
+		return ""
+	}
+	if !filepath.IsAbs(modfile) && len(graphState.Dir) > 0 {
+		modfile = filepath.Join(graphState.Dir, modfile)
+	}
+	if abs, err := filepath.Abs(modfile); err == nil {
+		return abs
+	}
+	return modfile
+}
+
+// goFlags returns the ambient GOFLAGS followed by those implied by
+// --goflags, --modfile, if withModFile is true, and --tags. Later flags
+// take precedence over earlier ones.
+func goFlags(withModFile bool) []string {
+	flags := []string{}
+	if goflags := os.Getenv("GOFLAGS"); len(goflags) > 0 {
+		flags = append(flags, goflags)
+	}
+	if len(graphState.GoFlags) > 0 {
+		flags = append(flags, graphState.GoFlags)
+	}
+	if modfile := modFile(); len(modfile) > 0 && withModFile {
+		flags = append(flags, "-modfile="+modfile)
+	}
+	if len(graphState.Tags) > 0 {
+		flags = append(flags, "-tags="+graphState.Tags)
+	}
+	return flags
+}
+
+// buildContextEnv returns the environment variables that implement the
+// build context flags.
+func buildContextEnv() []string {
+	env := []string{}
+	if flags := goFlags(true); len(flags) > 0 {
+		env = append(env, "GOFLAGS="+strings.Join(flags, " "))
+	}
+	for _, v := range []struct{ name, value string }{
+		{"GOWORK", graphState.GoWork},
+		{"GOOS", graphState.GOOS},
+		{"GOARCH", graphState.GOARCH},
+	} {
+		if len(v.value) > 0 {
+			env = append(env, v.name+"="+v.value)
+		}
+	}
+	return env
+}
+
+// getGoMod returns the go.mod file in use, that is, the file specified by
+// --modfile or the main module's go.mod, and its go.sum file.
+func getGoMod(ctx context.Context) (string, string, error) {
+	gomod := modFile()
+	if len(gomod) == 0 {
+		env, err := getGoEnv(ctx, "GOMOD")
+		if err != nil {
+			return "", "", err
+		}
+		gomod = env["GOMOD"]
+		if len(gomod) == 0 || gomod == os.DevNull {
+			return "", "", fmt.Errorf("not in a go module")
+		}
+	}
+	return gomod, strings.TrimSuffix(gomod, ".mod") + ".sum", nil
+}
+
+func (gc goCmd) command(ctx context.Context, stderr *bytes.Buffer, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, goCommand(), args...)
+	cmd.Dir = gc.Dir
+	if len(cmd.Dir) == 0 {
+		cmd.Dir = graphState.Dir
+	}
+	// Later values take precedence over earlier ones.
+	if env := append(buildContextEnv(), gc.Env...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stderr = stderr
+	return cmd
+}
+
+func commandError(args []string, stderr *bytes.Buffer, err error) error {
+	return fmt.Errorf("failed to run `go %v`: %v: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+}
+
+// output runs the go command with the supplied arguments and returns its
+// standard output. Standard error is included in any returned error.
+func (gc goCmd) output(ctx context.Context, args ...string) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	output, err := gc.command(ctx, buf, args...).Output()
+	if err != nil {
+		return nil, commandError(args, buf, err)
+	}
+	return output, nil
+}
+
+// stream runs the go command with the supplied arguments and calls fn
+// to read its standard output as it is produced. The command is killed if
+// fn returns an error or ctx is canceled.
+func (gc goCmd) stream(ctx context.Context, fn func(io.Reader) error, args ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	buf := bytes.NewBuffer(nil)
+	cmd := gc.command(ctx, buf, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return commandError(args, buf, err)
+	}
+	err = fn(stdout)
+	if err != nil {
+		cancel()
+	}
+	if werr := cmd.Wait(); err == nil && werr != nil {
+		return commandError(args, buf, werr)
+	}
+	return err
+}
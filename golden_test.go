@@ -0,0 +1,302 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// fixture is a captured go mod graph and go list -m all output, and
+// optionally the main module's go.mod, or those of the modules in a
+// workspace, in testdata/<name>.
+type fixture struct {
+	name     string
+	root     string
+	raw      []dependency
+	selected map[string]string
+	mc       *modCache
+}
+
+func loadFixture(t *testing.T, name string) *fixture {
+	dir := filepath.Join("testdata", name)
+	open := func(filename string) *os.File {
+		f, err := os.Open(filepath.Join(dir, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	fx := &fixture{name: name}
+	f := open("modgraph.txt")
+	defer f.Close()
+	malformed, err := parseModGraph(context.Background(), f, func(dep dependency) {
+		fx.raw = append(fx.raw, dep)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(malformed) > 0 {
+		t.Fatalf("%v: %v", name, malformedError(malformed))
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "list.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fx.selected, err = parseSelectedVersions(bytes.NewReader(buf)); err != nil {
+		t.Fatal(err)
+	}
+	fx.root = strings.Fields(string(buf))[0]
+	fx.mc = &modCache{
+		dir:    filepath.Join(dir, "modcache"),
+		gomod:  filepath.Join(dir, "go.mod"),
+		gomods: map[string]string{},
+		parsed: map[string]*modfile.File{},
+	}
+	// As for the fake go command, the go.mod files of the modules in a
+	// workspace are in directories named for the last element of their
+	// paths.
+	for m, version := range fx.selected {
+		gomod := filepath.Join(dir, path.Base(m), "go.mod")
+		if _, err := os.Stat(gomod); len(version) == 0 && err == nil {
+			fx.mc.gomods[m] = gomod
+		}
+	}
+	return fx
+}
+
+func (fx *fixture) graph(t *testing.T, versioned bool) (*graph, []string) {
+	dependencies, unique, ordered := processGraph(fx.raw, versioned)
+	gr, err := buildGraph(dependencies, unique, &diagnostics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gr, ordered
+}
+
+// compareGolden compares got with testdata/<fixture>/<name>.golden, or
+// writes it there if -update is specified.
+func compareGolden(t *testing.T, fixture, name string, got []byte) {
+	filename := filepath.Join("testdata", fixture, name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(filename, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("%v: %v, run go test -update to create it", filename, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%v: output differs from golden file, run go test -update and review the diff", filename)
+	}
+}
+
+var goldenFixtures = []struct {
+	name      string
+	versioned bool
+	contains  string
+	dependent string
+}{
+	{"small", false, "example.com/c", "golang.org/x/text"},
+	{"cyclic", false, "example.com/w", "example.com/x"},
+	{"versioned", true, "example.com/util@v0.1.0", "example.com/util@v0.3.0"},
+	{"workspace", false, "golang.org/x/tools", "golang.org/x/mod"},
+	{"huge", false, "golang.org/x/text", "golang.org/x/sys"},
+}
+
+// withGraphState runs fn with graphState reset to its defaults and
+// versioned set as specified.
+func withGraphState(versioned bool, fn func()) {
+	saved := graphState
+	defer func() { graphState = saved }()
+	graphState = graphStateDef{Versioned: versioned, Dependencies: true}
+	fn()
+}
+
+func TestGoldenDot(t *testing.T) {
+	for _, tc := range goldenFixtures {
+		fx := loadFixture(t, tc.name)
+		withGraphState(tc.versioned, func() {
+			graph, err := newAnnotatedGraph(fx.root, fx.raw, fx.selected, fx.mc, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := &bytes.Buffer{}
+			if err := graphDotTpl.Execute(out, graph); err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, tc.name, "dot", out.Bytes())
+		})
+	}
+}
+
+func TestDotEscape(t *testing.T) {
+	name := `my "group" \ 2`
+	graph := &annotatedGraph{
+		Root:     "example.com/app",
+		Legend:   true,
+		Groups:   []annotatedGroup{{Name: name, Color: "#ffffff"}},
+		Clusters: []cluster{{Name: name, Modules: []string{"example.com/app"}}},
+	}
+	out := &bytes.Buffer{}
+	if err := graphDotTpl.Execute(out, graph); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`label = "my \"group\" \\ 2";`,
+		`"legend: group 0" [label = "my \"group\" \\ 2", style = filled`,
+	} {
+		if got := out.String(); !strings.Contains(got, want) {
+			t.Errorf("got %v, want it to contain %v", got, want)
+		}
+	}
+}
+
+func TestGoldenExport(t *testing.T) {
+	for _, tc := range goldenFixtures[:4] {
+		fx := loadFixture(t, tc.name)
+		// Metadata with characters that must be escaped in every format.
+		module := ""
+		for _, dep := range fx.raw {
+			if !isPseudoModule(dep.DependsOn) {
+				module = dep.DependsOn
+				break
+			}
+		}
+		if !tc.versioned {
+			module = stripVersion(module)
+		}
+		metadata := map[string]*moduleMetadata{
+			module: {
+				GoVersion:  "1.21",
+				Time:       time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+				Deprecated: "use \"example.com/new\" instead, see <https://example.com/new?a=1&b=2>\n\tor C:\\new",
+				Retracted:  true,
+				Rationale:  "it's broken\a",
+				Packages:   3,
+				Size:       1024,
+			},
+		}
+		withGraphState(tc.versioned, func() {
+			graphState.Metadata = true
+			graph, err := newAnnotatedGraph(fx.root, fx.raw, fx.selected, fx.mc, nil, metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, format := range []struct{ name, table string }{
+				{"graphml", ""},
+				{"gexf", ""},
+				{"mermaid", ""},
+				{"cypher", ""},
+				{"csv", "nodes"},
+				{"csv", "edges"},
+				{"jsonl", ""},
+			} {
+				graphState.ExportCSVTable = format.table
+				out := &bytes.Buffer{}
+				if err := exporters[format.name](out, graph); err != nil {
+					t.Fatalf("%v: %v: %v", tc.name, format.name, err)
+				}
+				golden := "export." + format.name
+				if len(format.table) > 0 {
+					golden = "export-" + format.table + "." + format.name
+				}
+				compareGolden(t, tc.name, golden, out.Bytes())
+			}
+		})
+	}
+}
+
+func TestCypherQuote(t *testing.T) {
+	for _, tc := range []struct{ in, out string }{
+		{"", `''`},
+		{"example.com/a", `'example.com/a'`},
+		{`it's "quoted"`, `'it\'s "quoted"'`},
+		{`C:\dir`, `'C:\\dir'`},
+		{"a\tb\nc\rd\be\ff", `'a\tb\nc\rd\be\ff'`},
+		{"bell\a\v\x00\x7f", `'bell\u0007\u000B\u0000\u007F'`},
+		{"héllo, 世界 🙂", `'héllo, 世界 🙂'`},
+	} {
+		if got, want := cypherQuote(tc.in), tc.out; got != want {
+			t.Errorf("%q: got %v, want %v", tc.in, got, want)
+		}
+	}
+}
+
+func TestGoldenQuery(t *testing.T) {
+	for _, tc := range goldenFixtures {
+		fx := loadFixture(t, tc.name)
+		gr, _ := fx.graph(t, tc.versioned)
+		for _, query := range []struct {
+			golden, start, contains string
+			dependencies            bool
+		}{
+			{"query", fx.root, "", true},
+			{"query-contains", fx.root, tc.contains, true},
+			{"query-dependents", tc.dependent, "", false},
+			{"query-dependents-contains", tc.dependent, fx.root, false},
+		} {
+			out := &bytes.Buffer{}
+			gr.queryTree(query.start, query.contains, query.dependencies).print(out, 0)
+			compareGolden(t, tc.name, query.golden, out.Bytes())
+		}
+	}
+}
+
+func TestGoldenWheel(t *testing.T) {
+	for _, tc := range goldenFixtures {
+		fx := loadFixture(t, tc.name)
+		gr, ordered := fx.graph(t, tc.versioned)
+		dm := newCompactDM(gr.compact(), ordered)
+		out := &bytes.Buffer{}
+		out.WriteString(dm.moduleNames() + "\n")
+		out.WriteString(dm.matrix() + "\n")
+		out.WriteString(dm.groups(prefixGrouper(2)) + "\n")
+		compareGolden(t, tc.name, "wheel", out.Bytes())
+	}
+}
+
+func TestGoldenITree(t *testing.T) {
+	for _, tc := range goldenFixtures {
+		fx := loadFixture(t, tc.name)
+		gr, _ := fx.graph(t, tc.versioned)
+		buf, err := json.MarshalIndent(newTreesJS(gr, fx.root, "", fx.selected, nil), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareGolden(t, tc.name, "itree", append(buf, '\n'))
+	}
+}
+
+func TestGoldenRender(t *testing.T) {
+	for _, tc := range goldenFixtures[:3] {
+		fx := loadFixture(t, tc.name)
+		dependencies, unique, ordered := processGraph(fx.raw, tc.versioned)
+		rd, err := newRendering(dependencies, unique, ordered, prefixGrouper(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		if err := rd.writeSVG(out); err != nil {
+			t.Fatal(err)
+		}
+		compareGolden(t, tc.name, "render.svg", out.Bytes())
+	}
+}
@@ -9,12 +9,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
+	"io"
 	"sort"
 	"strings"
-	"text/template"
 
 	"github.com/spf13/cobra"
 	"v.io/x/lib/cmd/pflagvar"
@@ -25,12 +22,6 @@ var graphCmd = &cobra.Command{
 	Short: "module dependency graph related commands",
 }
 
-var graphDotCmd = &cobra.Command{
-	Use:   "dot",
-	Short: "output dependency graph in dot format",
-	RunE:  graphDot,
-}
-
 var graphQueryCmd = &cobra.Command{
 	Use:   "query",
 	Short: "query the dependency graph",
@@ -38,23 +29,53 @@ var graphQueryCmd = &cobra.Command{
 }
 
 type graphStateDef struct {
-	Versioned    bool   `graph:"versioned,false,'if set, module versions are tracked'"`
-	DotFormat    string `dot:"format,,set to a dot output format to run dot internally to generate that format"`
-	DotCommand   string `dot:"command,sfdp,command to run to process dot script"`
-	Start        string `query:"start,,module to start dependency analysis"`
-	Dependencies bool   `query:"dependencies,true,set to false to trace dependents rather than dependencies"`
-	Contains     string `query:"contains,,specify a module to be found in the dependencie or dependent module paths"`
+	NoCache         bool   `cache:"no-cache,false,do not use or update the cache of go command output"`
+	GoCommand       string `go:"go,go,'the go command to run, eg. a specific go release or a script that returns canned output for tests'"`
+	Dir             string `build:"dir,,'directory containing the module to analyze, defaults to the current directory'"`
+	ModFile         string `build:"modfile,,'alternate go.mod file to use, as per go -modfile, relative to --dir if specified, the go.sum file is that with the .mod suffix replaced by .sum'"`
+	GoFlags         string `build:"goflags,,'flags to append to GOFLAGS for all go commands, eg. -mod=mod'"`
+	GoWork          string `build:"gowork,,'value of GOWORK for all go commands, eg. off to disable workspace mode'"`
+	Tags            string `build:"tags,,comma separated list of build tags"`
+	GOOS            string `build:"goos,,value of GOOS for all go commands"`
+	GOARCH          string `build:"goarch,,value of GOARCH for all go commands"`
+	Strict          bool   `parse:"strict,false,'fail if the output of go mod graph has malformed lines or dependencies on unrecognised modules rather than reporting them as warnings'"`
+	Versioned       bool   `graph:"versioned,false,'if set, module versions are tracked'"`
+	GroupBy         string `graph:"group-by,,'group modules by host, org, prefix-depth=N or according to the rules in the specified .yaml file'"`
+	Metadata        bool   `graph:"metadata,false,'annotate modules with metadata from the module cache: go version, release time, deprecation, retraction and package count and size'"`
+	Classify        bool   `graph:"classify,false,'classify modules as production, test-only, tool-only or unimported by loading the packages of the main module with and without their tests'"`
+	DotFormat       string `dot:"format,,set to a dot output format to run dot internally to generate that format"`
+	DotCommand      string `dot:"command,sfdp,command to run to process dot script"`
+	DotRankDir      string `dot:"rankdir,,'rank direction for the graph: TB, LR, BT or RL'"`
+	DotLayout       string `dot:"layout,,'graphviz layout engine to request in the graph, eg. dot, neato or sfdp'"`
+	DotLabels       bool   `dot:"edge-labels,false,label edges with the required versions"`
+	DotLegend       bool   `dot:"legend,false,include a legend"`
+	DotTemplate     string `dot:"template,,a text/template file to use instead of the builtin dot template"`
+	Out             string `out:"out,,write the output to the specified file rather than stdout"`
+	RenderFormat    string `render:"format,,'image format: svg or png, defaults to the extension of --out or svg'"`
+	ExportFormat    string `export:"format,jsonl,'output format: graphml, gexf, mermaid, cypher, csv or jsonl'"`
+	ExportCSVTable  string `export:"csv-table,edges,'the table to write for --format=csv: nodes or edges'"`
+	ReportDir       string `report:"report-dir,report,directory to write the report to"`
+	OutdatedProxy   string `outdated:"proxy,,'GOPROXY style directory or file:// URL to read available versions from, defaults to the module download cache'"`
+	DominatorTree   bool   `dominators:"tree,false,display the dominator tree rather than a table"`
+	HistorySince    string `history:"since,,'git revision, eg. a tag or commit, to start from, defaults to the first commit'"`
+	HistoryEvery    int    `history:"every,1,'only analyze every Nth commit that changed go.mod or go.sum, the first and last are always analyzed'"`
+	HistoryFormat   string `history:"format,text,'output format: text, json or html, html includes a chart of the module count and depth'"`
+	Targets         string `pkggraph:"targets,'linux/amd64,windows/amd64,darwin/arm64',comma separated list of GOOS/GOARCH build targets"`
+	Packages        string `pkggraph:"packages,./...,space separated list of packages to load"`
+	Start           string `query:"start,,module to start dependency analysis"`
+	Dependencies    bool   `query:"dependencies,true,set to false to trace dependents rather than dependencies"`
+	Contains        string `query:"contains,,specify a module to be found in the dependencie or dependent module paths"`
+	Where           string `query:"where,,'only display paths that include a module whose metadata satisfies all of the comma separated conditions: deprecated, retracted or go, packages, size or released compared to a value, eg. go<1.17 or released<2020-01-01'"`
+	DuplicateMajors bool   `query:"duplicate-majors,false,only display paths that include modules that are required at more than one major version"`
+	Usage           string `query:"usage,,'only display paths that include a module with one of the comma separated usages: production, test, tool or unimported, see --classify'"`
 }
 
 var graphState graphStateDef
 
 func init() {
 	rootCmd.AddCommand(graphCmd)
-	graphCmd.AddCommand(graphDotCmd)
 	graphCmd.AddCommand(graphQueryCmd)
 
-	must(pflagvar.RegisterFlagsInStruct(graphDotCmd.Flags(), "graph", &graphState, nil, nil))
-	must(pflagvar.RegisterFlagsInStruct(graphDotCmd.Flags(), "dot", &graphState, nil, nil))
 	must(pflagvar.RegisterFlagsInStruct(graphQueryCmd.Flags(), "graph", &graphState, nil, nil))
 	must(pflagvar.RegisterFlagsInStruct(graphQueryCmd.Flags(), "query", &graphState, nil, nil))
 }
@@ -63,149 +84,168 @@ type dependency struct {
 	Module, DependsOn string
 }
 
-func getRoot(ctx context.Context) (string, error) {
-	buf := bytes.NewBuffer(nil)
-	cmd := exec.CommandContext(ctx, "go", "list", "-m")
-	cmd.Stderr = buf
-	output, err := cmd.Output()
+func getRoot(ctx context.Context, gc goCmd) (string, error) {
+	cache := cacheFor(ctx, gc)
+	var root string
+	if cache.get("root", &root) {
+		return root, nil
+	}
+	output, err := gc.output(ctx, "list", "-m")
 	if err != nil {
-		return "", fmt.Errorf("failed to run `go list -m`: %v: %v", buf.String(), err)
+		return "", err
 	}
-	return strings.TrimSuffix(string(output), "\n"), nil
+	// In workspace mode all of the main modules are listed, use the first.
+	root = strings.SplitN(strings.TrimSuffix(string(output), "\n"), "\n", 2)[0]
+	cache.put("root", root)
+	return root, nil
 }
 
-func getGraph(ctx context.Context, versioned bool) ([]dependency, map[string]bool, []string, error) {
-	// Use go mod graph to get the raw dependencies.
-	ordered := []string{}
-	buf := bytes.NewBuffer(nil)
-	cmd := exec.CommandContext(ctx, "go", "mod", "graph")
-	cmd.Stderr = buf
-	output, err := cmd.Output()
+// getSelectedVersions returns the version of each module selected by
+// minimal version selection as reported by `go list -m all`.
+func getSelectedVersions(ctx context.Context, gc goCmd) (map[string]string, error) {
+	cache := cacheFor(ctx, gc)
+	versions := map[string]string{}
+	if cache.get("selected", &versions) {
+		return versions, nil
+	}
+	output, err := gc.output(ctx, "list", "-m", "all")
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to run `go mod graph`: %v: %v", buf.String(), err)
+		return nil, err
 	}
+	versions, err = parseSelectedVersions(bytes.NewBuffer(output))
+	if err != nil {
+		return nil, err
+	}
+	cache.put("selected", versions)
+	return versions, nil
+}
 
-	scanOutput := func(fn func(a, b string)) error {
-		sc := bufio.NewScanner(bytes.NewBuffer(output))
-		for sc.Scan() {
-			line := sc.Text()
-			parts := strings.Split(line, " ")
-			if len(parts) != 2 {
-				fmt.Fprintf(os.Stderr, "invalid input line: %v\n", line)
-				continue
-			}
-			fn(parts[0], parts[1])
-		}
-		return sc.Err()
-	}
-
-	dependencies := []dependency{}
-	unique := map[string]bool{}
-	dupOrdered := []string{}
-	if !versioned {
-		// strip all versions and dedup.
-		deduped := map[string]bool{}
-		err = scanOutput(func(mod, dep string) {
-			mod = stripVersion(mod)
-			dep = stripVersion(dep)
-			deduped[mod+" "+dep] = true
-			dupOrdered = append(dupOrdered, mod)
-			dupOrdered = append(dupOrdered, dep)
-		})
-		for k := range deduped {
-			parts := strings.Split(k, " ")
-			mod, dep := parts[0], parts[1]
-			unique[mod] = true
-			unique[dep] = true
-			dependencies = append(dependencies, dependency{Module: mod, DependsOn: dep})
+// parseSelectedVersions parses the output of `go list -m all`. The main
+// modules, which includes all of the modules in a workspace, have no
+// version.
+func parseSelectedVersions(rd io.Reader) (map[string]string, error) {
+	versions := map[string]string{}
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		// <module> [<version> [=> <replacement> [<version>]]]
+		parts := strings.Fields(sc.Text())
+		switch {
+		case len(parts) >= 2:
+			versions[parts[0]] = parts[1]
+		case len(parts) == 1:
+			versions[parts[0]] = ""
 		}
-		dedup := map[string]bool{}
-		for _, m := range dupOrdered {
-			if !dedup[m] {
-				ordered = append(ordered, m)
-			}
-			dedup[m] = true
-		}
-	} else {
-		err = scanOutput(func(mod, dep string) {
-			if _, ok := unique[mod]; !ok {
-				ordered = append(ordered, mod)
-			}
-			if _, ok := unique[dep]; !ok {
-				ordered = append(ordered, dep)
-			}
-			unique[mod] = true
-			unique[dep] = true
-			dependencies = append(dependencies, dependency{Module: mod, DependsOn: dep})
-		})
-	}
-	if err != nil {
-		return nil, nil, nil, err
 	}
-	return dependencies, unique, ordered, nil
+	return versions, sc.Err()
 }
 
-func stripVersion(m string) string {
-	if idx := strings.Index(m, "@"); idx > 0 {
-		return m[:idx]
+// moduleGraphs holds the graphs built by getGraph for the current module,
+// indexed by versioned, so that each command, and in particular report
+// which writes many files, runs go mod graph at most once. It is reset
+// before each command is run. The returned slices and maps are shared
+// and must not be modified.
+var moduleGraphs = map[bool]*graphBuilder{}
+
+// getGraph returns the dependencies, the set of unique modules and the
+// modules in the order in which they first appear in the output of
+// go mod graph for the current module, which is fed to a graphBuilder as
+// it is parsed rather than being collected first. The dependencies of a
+// versioned graph are the raw output of go mod graph and if one has
+// already been built they are used to build an unversioned one.
+func getGraph(ctx context.Context, versioned bool) ([]dependency, map[string]bool, []string, error) {
+	gb := moduleGraphs[versioned]
+	if gb == nil {
+		gb = newGraphBuilder(versioned)
+		if raw := moduleGraphs[true]; raw != nil {
+			for _, dep := range raw.dependencies {
+				gb.add(dep)
+			}
+		} else {
+			diag, err := streamModGraph(ctx, goCmd{}, gb.add)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			moduleDiagnostics.Malformed = diag.Malformed
+		}
+		moduleGraphs[versioned] = gb
 	}
-	return m
+	return gb.dependencies, gb.unique, gb.ordered, nil
 }
 
-var graphDotTpl = template.Must(template.New("dot").Parse(`
-digraph {
-	graph [overlap=false, size=14];
-	root="{{.Root}}";
-	node [  shape = plaintext, fontname = "Helvetica", fontsize=24];
-	"{{.Root}}" [style = filled, fillcolor = "#E94762"];
-{{range .Dependencies}}"{{.Module}}" -> "{{.DependsOn}}"
-{{end}}
+// getModGraph returns the raw, versioned, dependencies reported by
+// go mod graph in the order that they are reported and the problems
+// found in its output.
+func getModGraph(ctx context.Context, gc goCmd) ([]dependency, *diagnostics, error) {
+	var raw []dependency
+	diag, err := streamModGraph(ctx, gc, func(dep dependency) {
+		raw = append(raw, dep)
+	})
+	return raw, diag, err
 }
-`))
 
-func graphDot(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
-	root, err := getRoot(ctx)
-	if err != nil {
-		return err
+// streamModGraph calls add for each of the raw dependencies reported by
+// go mod graph, in order, as its output is parsed or, if it is cached,
+// as it is read from the cache. The dependencies are only retained if
+// they need to be written to the cache. Malformed lines are returned as
+// diagnostics, or as an error if --strict is specified.
+func streamModGraph(ctx context.Context, gc goCmd, add func(dependency)) (*diagnostics, error) {
+	cache := cacheFor(ctx, gc)
+	var mg struct {
+		Dependencies []dependency
+		Malformed    []*lineError
 	}
-	dependencies, _, _, err := getGraph(ctx, graphState.Versioned)
-	if err != nil {
-		return err
+	if cache.get("modgraph", &mg) {
+		for _, dep := range mg.Dependencies {
+			add(dep)
+		}
+	} else {
+		err := gc.stream(ctx, func(rd io.Reader) error {
+			var err error
+			mg.Malformed, err = parseModGraph(ctx, rd, func(dep dependency) {
+				if cache != nil {
+					mg.Dependencies = append(mg.Dependencies, dep)
+				}
+				add(dep)
+			})
+			return err
+		}, "mod", "graph")
+		if err != nil {
+			return nil, err
+		}
+		cache.put("modgraph", mg)
 	}
-	graph := struct {
-		Root         string
-		Dependencies []dependency
-	}{
-		Root:         root,
-		Dependencies: dependencies,
+	if len(mg.Malformed) > 0 && graphState.Strict {
+		return nil, malformedError(mg.Malformed)
 	}
-	format := graphState.DotFormat
-	if len(format) == 0 {
-		// output raw dot format
-		return graphDotTpl.Execute(os.Stdout, &graph)
+	return &diagnostics{Malformed: mg.Malformed}, nil
+}
+
+// processGraph returns the dependencies, the set of unique modules and
+// the modules in the order in which they first appear in the raw
+// dependencies. If versioned is false, all versions are stripped and
+// the dependencies deduplicated.
+func processGraph(raw []dependency, versioned bool) ([]dependency, map[string]bool, []string) {
+	gb := newGraphBuilder(versioned)
+	for _, dep := range raw {
+		gb.add(dep)
 	}
+	return gb.dependencies, gb.unique, gb.ordered
+}
 
-	writeDotFile := func() (string, error) {
-		tmpfile, err := ioutil.TempFile("", "dot-*.dot")
-		if err != nil {
-			return "", err
-		}
-		defer tmpfile.Close()
-		if err := graphDotTpl.Execute(tmpfile, &graph); err != nil {
-			os.Remove(tmpfile.Name())
-			return tmpfile.Name(), err
-		}
-		return tmpfile.Name(), nil
+func stripVersion(m string) string {
+	if idx := strings.Index(m, "@"); idx > 0 {
+		return m[:idx]
 	}
-	name, err := writeDotFile()
-	if err != nil {
-		return err
+	return m
+}
+
+// moduleVersion returns the version of the supplied module, using its
+// own version if it has one or the selected version otherwise.
+func moduleVersion(m string, selected map[string]string) string {
+	if idx := strings.Index(m, "@"); idx > 0 {
+		return m[idx+1:]
 	}
-	defer os.Remove(name)
-	dotcmd := exec.CommandContext(ctx, graphState.DotCommand, "-T"+format, name)
-	dotcmd.Stdout = os.Stdout
-	return dotcmd.Run()
+	return selected[m]
 }
 
 type graphNode struct {
@@ -215,25 +255,39 @@ type graphNode struct {
 }
 
 type graph struct {
-	nodes map[string]*graphNode
+	nodes     map[string]*graphNode
+	compacted *compactGraph // created on demand by compact.
 }
 
-// buildGraph builds the dependency graph, including cycles.
-func buildGraph(dependencies []dependency, unique map[string]bool) (*graph, error) {
+// buildGraph builds the dependency graph, including cycles. Modules that
+// are not in unique are added to the graph and recorded in diag unless
+// --strict is specified.
+func buildGraph(dependencies []dependency, unique map[string]bool, diag *diagnostics) (*graph, error) {
 	nodes := make(map[string]*graphNode, len(unique))
 	for k := range unique {
 		nodes[k] = &graphNode{
 			module: k,
 		}
 	}
+	lookup := func(m, what string) (*graphNode, error) {
+		if gn := nodes[m]; gn != nil {
+			return gn, nil
+		}
+		if graphState.Strict {
+			return nil, fmt.Errorf("uncrecognised %v: %v", what, m)
+		}
+		diag.addUnrecognised(m)
+		nodes[m] = &graphNode{module: m}
+		return nodes[m], nil
+	}
 	for _, dep := range dependencies {
-		mod := nodes[dep.Module]
-		if mod == nil {
-			return nil, fmt.Errorf("uncrecognised module: %v", dep.Module)
+		mod, err := lookup(dep.Module, "module")
+		if err != nil {
+			return nil, err
 		}
-		dependency := nodes[dep.DependsOn]
-		if dependency == nil {
-			return nil, fmt.Errorf("uncrecognised module dependency: %v", dep.DependsOn)
+		dependency, err := lookup(dep.DependsOn, "module dependency")
+		if err != nil {
+			return nil, err
 		}
 		mod.dependencies = append(mod.dependencies, dependency)
 		dependency.dependents = append(dependency.dependents, mod)
@@ -241,56 +295,84 @@ func buildGraph(dependencies []dependency, unique map[string]bool) (*graph, erro
 	return &graph{nodes: nodes}, nil
 }
 
-type treeNode struct {
-	Module   string
-	Cycle    string
-	Children map[string]*treeNode
-}
-
-// given a starting point, create a tree of dependencies from it, taking
-// care to detect cycles.
-func (gr *graph) dependencyTree(c *treeNode) map[string]*treeNode {
-	r, _ := gr.flatten(c, func(gn *graphNode) []*graphNode {
-		sort.Slice(gn.dependencies, func(i, j int) bool {
-			return gn.dependencies[i].module < gn.dependencies[j].module
-		})
-		return gn.dependencies
-	}, map[string]bool{})
-	return r
-}
-
-// given a starting point, create a tree of dependents from it, taking
-// care to detect cycles.
-func (gr *graph) dependentTree(c *treeNode) map[string]*treeNode {
-	r, _ := gr.flatten(c, func(gn *graphNode) []*graphNode {
-		sort.Slice(gn.dependents, func(i, j int) bool {
-			return gn.dependents[i].module < gn.dependents[j].module
-		})
-		return gn.dependents
-	}, map[string]bool{})
-	return r
+// components returns the strongly connected component that each module
+// belongs to, numbered in the order in which they are found. Two modules
+// are in a cycle if and only if they are in the same component.
+func (gr *graph) components() map[string]int {
+	modules := make([]string, 0, len(gr.nodes))
+	for k := range gr.nodes {
+		modules = append(modules, k)
+	}
+	sort.Strings(modules)
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	component := map[string]int{}
+	ncomponents := 0
+	var strongconnect func(gn *graphNode)
+	strongconnect = func(gn *graphNode) {
+		index[gn.module] = len(index)
+		lowlink[gn.module] = index[gn.module]
+		stack = append(stack, gn.module)
+		onStack[gn.module] = true
+		for _, dep := range gn.dependencies {
+			if _, ok := index[dep.module]; !ok {
+				strongconnect(dep)
+				if lowlink[dep.module] < lowlink[gn.module] {
+					lowlink[gn.module] = lowlink[dep.module]
+				}
+			} else if onStack[dep.module] && index[dep.module] < lowlink[gn.module] {
+				lowlink[gn.module] = index[dep.module]
+			}
+		}
+		if lowlink[gn.module] != index[gn.module] {
+			return
+		}
+		for {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[m] = false
+			component[m] = ncomponents
+			if m == gn.module {
+				break
+			}
+		}
+		ncomponents++
+	}
+	for _, m := range modules {
+		if _, ok := index[m]; !ok {
+			strongconnect(gr.nodes[m])
+		}
+	}
+	return component
 }
 
-func (gr *graph) flatten(c *treeNode, follow func(gn *graphNode) []*graphNode, visited map[string]bool) (map[string]*treeNode, bool) {
-	gn := gr.nodes[c.Module]
-	if cycle := visited[c.Module]; gn == nil || cycle {
-		// detected a cycle
-		return nil, true
-	}
-	visited[c.Module] = true
-	c.Children = map[string]*treeNode{}
-	for _, dep := range follow(gn) {
-		dt := &treeNode{Module: dep.module}
-		sdeps, cycle := gr.flatten(dt, follow, visited)
-		if cycle {
-			c.Cycle = dt.Module
-		}
-		for k, v := range sdeps {
-			dt.Children[k] = v
+// cycles returns the modules that make up each cycle in the graph, that
+// is, each strongly connected component with more than one module. The
+// modules in each cycle, and the cycles themselves, are sorted.
+func (gr *graph) cycles() [][]string {
+	members := map[int][]string{}
+	for m, c := range gr.components() {
+		members[c] = append(members[c], m)
+	}
+	cycles := [][]string{}
+	for _, modules := range members {
+		if len(modules) > 1 {
+			sort.Strings(modules)
+			cycles = append(cycles, modules)
 		}
-		c.Children[dep.module] = dt
 	}
-	return c.Children, false
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+type treeNode struct {
+	Module   string
+	Cycle    string
+	Children map[string]*treeNode
 }
 
 func filter(dt *treeNode, match func(tn *treeNode) bool, matched bool) *treeNode {
@@ -318,14 +400,14 @@ func filter(dt *treeNode, match func(tn *treeNode) bool, matched bool) *treeNode
 	return mod
 }
 
-func (dt *treeNode) print(depth int) {
+func (dt *treeNode) print(out io.Writer, depth int) {
 	if dt == nil {
 		return
 	}
 	if cycle := dt.Cycle; len(cycle) > 0 {
-		fmt.Printf("%v%v (cycle -> %v)\n", strings.Repeat(" ", depth*2), dt.Module, cycle)
+		fmt.Fprintf(out, "%v%v (cycle -> %v)\n", strings.Repeat(" ", depth*2), dt.Module, cycle)
 	} else {
-		fmt.Printf("%v%v\n", strings.Repeat(" ", depth*2), dt.Module)
+		fmt.Fprintf(out, "%v%v\n", strings.Repeat(" ", depth*2), dt.Module)
 	}
 	children := make([]string, 0, len(dt.Children))
 	for c := range dt.Children {
@@ -333,39 +415,75 @@ func (dt *treeNode) print(depth int) {
 	}
 	sort.Strings(children)
 	for _, c := range children {
-		dt.Children[c].print(depth + 1)
+		dt.Children[c].print(out, depth+1)
 	}
 }
 
-func runQuery(ctx context.Context, start, contains string, versioned bool) (*treeNode, error) {
+// loadQueryGraph returns the dependency graph and the module to start
+// queries from, which defaults to the root module. If grouping is
+// requested the graph and start refer to groups rather than modules and
+// the grouper is returned so that other module names can be mapped to
+// their groups.
+func loadQueryGraph(ctx context.Context, start string, versioned bool) (*graph, string, grouper, error) {
 	if len(start) == 0 {
-		root, err := getRoot(ctx)
+		root, err := getRoot(ctx, goCmd{})
 		if err != nil {
-			return nil, err
+			return nil, "", nil, err
 		}
 		start = root
 	}
-	dependencies, unique, _, err := getGraph(ctx, versioned)
+	dependencies, unique, ordered, err := getGraph(ctx, versioned)
 	if err != nil {
-		return nil, err
+		return nil, "", nil, err
 	}
-	graph, err := buildGraph(dependencies, unique)
+	grp, err := newGrouper(graphState.GroupBy)
 	if err != nil {
-		return nil, err
+		return nil, "", nil, err
 	}
-	dt := &treeNode{Module: start}
-	if graphState.Dependencies {
-		dt.Children = graph.dependencyTree(dt)
-	} else {
-		dt.Children = graph.dependentTree(dt)
+	if grp != nil {
+		// report at the granularity of groups rather than modules.
+		start = grp(start)
+		dependencies, unique, _ = groupDependencies(dependencies, ordered, grp)
 	}
-	if contains := graphState.Contains; len(contains) > 0 {
-		filtered := filter(dt, func(tn *treeNode) bool {
-			return tn.Module == contains
-		}, false)
-		return filtered, nil
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return graph, start, grp, nil
+}
+
+// queryTree returns the tree of dependencies, or dependents, of start,
+// restricted to the paths that include contains if it is specified.
+// A nil tree is returned if no such paths exist.
+func (gr *graph) queryTree(start, contains string, dependencies bool) *treeNode {
+	cg := gr.compact()
+	n, ok := cg.index[start]
+	if !ok {
+		if len(contains) > 0 && contains != start {
+			return nil
+		}
+		return &treeNode{Module: start}
+	}
+	ct := cg.flatten(n, dependencies)
+	if len(contains) > 0 {
+		c, ok := cg.index[contains]
+		if !ok {
+			return nil
+		}
+		ct = ct.filter(func(m int32) bool { return m == c }, false)
 	}
-	return dt, nil
+	return cg.treeNode(ct)
+}
+
+func runQuery(ctx context.Context, start, contains string, versioned bool) (*treeNode, error) {
+	graph, start, grp, err := loadQueryGraph(ctx, start, versioned)
+	if err != nil {
+		return nil, err
+	}
+	if grp != nil && len(contains) > 0 {
+		contains = grp(contains)
+	}
+	return graph.queryTree(start, contains, graphState.Dependencies), nil
 }
 
 func graphQuery(cmd *cobra.Command, args []string) error {
@@ -374,6 +492,29 @@ func graphQuery(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	tree.print(0)
+	if graphState.DuplicateMajors && tree != nil {
+		modules := map[string]bool{}
+		tree.modules(modules)
+		all := make([]string, 0, len(modules))
+		for m := range modules {
+			all = append(all, m)
+		}
+		duplicates := duplicateMajors(all)
+		tree = filter(tree, func(tn *treeNode) bool {
+			_, ok := duplicates[modulePathBase(tn.Module)]
+			return ok
+		}, false)
+	}
+	if len(graphState.Where) > 0 && tree != nil {
+		if tree, err = filterByMetadata(ctx, tree, graphState.Where); err != nil {
+			return err
+		}
+	}
+	if len(graphState.Usage) > 0 && tree != nil {
+		if tree, err = filterByUsage(ctx, tree, graphState.Usage); err != nil {
+			return err
+		}
+	}
+	tree.print(cmd.OutOrStdout(), 0)
 	return nil
 }
@@ -0,0 +1,54 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestComponents(t *testing.T) {
+	for _, tc := range []struct {
+		fixture   string
+		versioned bool
+		cycles    [][]string // components with more than one module.
+		total     int
+	}{
+		{"small", false, nil, 5},
+		{"small", true, nil, 7},
+		{"cyclic", false, [][]string{
+			{"example.com/app", "example.com/x", "example.com/y", "example.com/z"},
+		}, 2},
+		{"cyclic", true, [][]string{
+			{"example.com/x@v1.0.0", "example.com/y@v1.0.0", "example.com/z@v1.0.0"},
+		}, 5},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		gr, _ := fx.graph(t, tc.versioned)
+		components := gr.components()
+		if got, want := len(components), len(gr.nodes); got != want {
+			t.Errorf("%v: versioned %v: got %v, want %v", tc.fixture, tc.versioned, got, want)
+		}
+		members := map[int][]string{}
+		for m, c := range components {
+			members[c] = append(members[c], m)
+		}
+		if got, want := len(members), tc.total; got != want {
+			t.Errorf("%v: versioned %v: got %v, want %v", tc.fixture, tc.versioned, got, want)
+		}
+		var cycles [][]string
+		for _, ms := range members {
+			if len(ms) > 1 {
+				sort.Strings(ms)
+				cycles = append(cycles, ms)
+			}
+		}
+		sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+		if got, want := cycles, tc.cycles; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: versioned %v: got %v, want %v", tc.fixture, tc.versioned, got, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// grouper maps a module to the name of the group, or cluster, that it
+// belongs to.
+type grouper func(module string) string
+
+// groupRules represents a yaml file of the form:
+//
+//	default: org
+//	groups:
+//	  - name: aws
+//	    modules: [github.com/aws/*]
+//	  - name: golang.org/x
+//	    modules: [golang.org/x/*]
+//
+// A trailing /* matches all modules below that prefix, otherwise modules
+// are matched using path.Match. Modules that match no rule are grouped
+// according to default, which may be any of the non-file specifications
+// accepted by newGrouper.
+type groupRules struct {
+	Default string `yaml:"default"`
+	Groups  []struct {
+		Name    string   `yaml:"name"`
+		Modules []string `yaml:"modules"`
+	} `yaml:"groups"`
+}
+
+// newGrouper returns a grouper for the supplied specification which
+// may be one of host, org, prefix-depth=N or the name of a yaml
+// rules file. An empty spec returns a nil grouper.
+func newGrouper(spec string) (grouper, error) {
+	switch {
+	case len(spec) == 0:
+		return nil, nil
+	case strings.HasSuffix(spec, ".yaml") || strings.HasSuffix(spec, ".yml"):
+		return readGroupRules(spec)
+	case spec == "host":
+		return prefixGrouper(1), nil
+	case spec == "org":
+		return prefixGrouper(2), nil
+	case strings.HasPrefix(spec, "prefix-depth="):
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "prefix-depth="))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid prefix depth: %v", spec)
+		}
+		return prefixGrouper(n), nil
+	}
+	return nil, fmt.Errorf("unsupported group specification: %v", spec)
+}
+
+// prefixGrouper groups modules by the first depth elements of their
+// path, ignoring any version.
+func prefixGrouper(depth int) grouper {
+	return func(module string) string {
+		parts := strings.Split(stripVersion(module), "/")
+		if len(parts) > depth {
+			parts = parts[:depth]
+		}
+		return strings.Join(parts, "/")
+	}
+}
+
+func readGroupRules(filename string) (grouper, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rules groupRules
+	if err := yaml.UnmarshalStrict(buf, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", filename, err)
+	}
+	def := prefixGrouper(2)
+	if len(rules.Default) > 0 {
+		if strings.HasSuffix(rules.Default, ".yaml") || strings.HasSuffix(rules.Default, ".yml") {
+			return nil, fmt.Errorf("%v: default grouping cannot be another rules file", filename)
+		}
+		if def, err = newGrouper(rules.Default); err != nil {
+			return nil, fmt.Errorf("%v: %v", filename, err)
+		}
+	}
+	for _, g := range rules.Groups {
+		for _, pattern := range g.Modules {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%v: group %v: invalid pattern %q: %v", filename, g.Name, pattern, err)
+			}
+		}
+	}
+	return func(module string) string {
+		module = stripVersion(module)
+		for _, g := range rules.Groups {
+			for _, pattern := range g.Modules {
+				if matchModule(pattern, module) {
+					return g.Name
+				}
+			}
+		}
+		return def(module)
+	}, nil
+}
+
+func matchModule(pattern, module string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/*"); prefix != pattern {
+		return module == prefix || strings.HasPrefix(module, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, module)
+	return matched
+}
+
+// groupDependencies collapses the supplied dependencies into dependencies
+// between groups. Dependencies between modules in the same group are
+// dropped. The results are in the same form as returned by getGraph.
+func groupDependencies(dependencies []dependency, ordered []string, grp grouper) ([]dependency, map[string]bool, []string) {
+	grouped := []dependency{}
+	unique := map[string]bool{}
+	seen := map[dependency]bool{}
+	for _, dep := range dependencies {
+		gdep := dependency{Module: grp(dep.Module), DependsOn: grp(dep.DependsOn)}
+		unique[gdep.Module] = true
+		unique[gdep.DependsOn] = true
+		if gdep.Module == gdep.DependsOn || seen[gdep] {
+			continue
+		}
+		seen[gdep] = true
+		grouped = append(grouped, gdep)
+	}
+	groupOrdered := []string{}
+	dedup := map[string]bool{}
+	for _, m := range ordered {
+		g := grp(m)
+		if !dedup[g] {
+			groupOrdered = append(groupOrdered, g)
+		}
+		dedup[g] = true
+	}
+	return grouped, unique, groupOrdered
+}
+
+type cluster struct {
+	Index   int
+	Name    string
+	Modules []string
+}
+
+// clusters returns the modules grouped into clusters, sorted by
+// cluster name.
+func clusters(modules map[string]bool, grp grouper) []cluster {
+	byName := map[string][]string{}
+	for m := range modules {
+		g := grp(m)
+		byName[g] = append(byName[g], m)
+	}
+	names := make([]string, 0, len(byName))
+	for k := range byName {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	cl := make([]cluster, len(names))
+	for i, n := range names {
+		sort.Strings(byName[n])
+		cl[i] = cluster{Index: i, Name: n, Modules: byName[n]}
+	}
+	return cl
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewGrouper(t *testing.T) {
+	if grp, err := newGrouper(""); grp != nil || err != nil {
+		t.Errorf("got %v, %v, want nil, nil", grp != nil, err)
+	}
+	rules := filepath.Join("testdata", "groups", "groups.yaml")
+	for _, tc := range []struct {
+		spec   string
+		groups map[string]string
+	}{
+		{"host", map[string]string{
+			"example.com/app":                     "example.com",
+			"github.com/google/martian/v3@v3.0.0": "github.com",
+			"gopkg.in/yaml.v2@v2.4.0":             "gopkg.in",
+			"go@1.21":                             "go",
+		}},
+		{"org", map[string]string{
+			"example.com/app":                     "example.com/app",
+			"github.com/google/martian/v3@v3.0.0": "github.com/google",
+			"golang.org/x/text@v0.3.7":            "golang.org/x",
+			"gopkg.in/yaml.v2@v2.4.0":             "gopkg.in/yaml.v2",
+		}},
+		{"prefix-depth=3", map[string]string{
+			"example.com/app":                     "example.com/app",
+			"github.com/google/martian/v3@v3.0.0": "github.com/google/martian",
+			"golang.org/x/text@v0.3.7":            "golang.org/x/text",
+		}},
+		{rules, map[string]string{
+			"cloud.google.com/go":                 "google",
+			"cloud.google.com/go/storage@v1.0.0":  "google",
+			"github.com/google/martian/v3@v3.0.0": "google",
+			"github.com/googleapis/gax-go/v2":     "github.com",
+			"golang.org/x/text@v0.3.7":            "golang.org/x",
+			"golang.org/x":                        "golang.org/x",
+			"gopkg.in/yaml.v2@v2.4.0":             "yaml",
+			"gopkg.in/yaml.v3":                    "yaml",
+			"gopkg.in/check.v1":                   "gopkg.in",
+			"example.com/app":                     "example.com",
+		}},
+	} {
+		grp, err := newGrouper(tc.spec)
+		if err != nil {
+			t.Errorf("%v: %v", tc.spec, err)
+			continue
+		}
+		for module, group := range tc.groups {
+			if got, want := grp(module), group; got != want {
+				t.Errorf("%v: %v: got %v, want %v", tc.spec, module, got, want)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"nested.yaml":  "default: " + rules + "\n",
+		"default.yaml": "default: prefix-depth=0\n",
+		"pattern.yml":  "groups:\n  - name: bad\n    modules: ['[example.com']\n",
+		"syntax.yaml":  "groups: [\n",
+	})
+	for _, tc := range []struct {
+		spec, err string
+	}{
+		{"domain", "unsupported group specification: domain"},
+		{"prefix-depth=0", "invalid prefix depth: prefix-depth=0"},
+		{"prefix-depth=x", "invalid prefix depth: prefix-depth=x"},
+		{filepath.Join(dir, "missing.yaml"), "missing.yaml"},
+		{filepath.Join("testdata", "groups", "unknown-field.yaml"), "field module not found"},
+		{filepath.Join(dir, "syntax.yaml"), "failed to parse"},
+		{filepath.Join(dir, "nested.yaml"), "default grouping cannot be another rules file"},
+		{filepath.Join(dir, "default.yaml"), "invalid prefix depth: prefix-depth=0"},
+		{filepath.Join(dir, "pattern.yml"), `group bad: invalid pattern "[example.com"`},
+	} {
+		_, err := newGrouper(tc.spec)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%v: got %v, want an error containing %q", tc.spec, err, tc.err)
+		}
+	}
+}
+
+func TestGroupDependencies(t *testing.T) {
+	fx := loadFixture(t, "small")
+	dependencies, _, ordered := processGraph(fx.raw, false)
+	grouped, unique, groupOrdered := groupDependencies(dependencies, ordered, prefixGrouper(1))
+	if got, want := grouped, []dependency{{Module: "example.com", DependsOn: "golang.org"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := unique, map[string]bool{"example.com": true, "golang.org": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := groupOrdered, []string{"example.com", "golang.org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,434 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/modfile"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "display how the dependency graph has changed over the git history of the module",
+	Long: `display how the dependency graph has changed over the git history of the
+module, starting at the revision specified by --since or the first commit. The
+go.mod and go.sum files at each commit that changed either of them are copied
+to a temporary directory and the graph is computed there using only the local
+module cache (ie. GOPROXY=off), commits for which that fails are reported as
+errors. For each commit the number of modules required, directly or
+indirectly, the depth of the graph, that is, the length of the longest of the
+shortest paths from the main module to any other module, and the modules that
+were added or removed are displayed. --every=N analyzes only every Nth commit
+to speed up long histories. --format=html generates a self contained page
+with a chart of the module count and depth.`,
+	Args: cobra.NoArgs,
+	RunE: graphHistory,
+}
+
+func init() {
+	graphCmd.AddCommand(graphHistoryCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphHistoryCmd.Flags(), "history", &graphState, nil, nil))
+}
+
+// gitCommit is a commit in the history of a module.
+type gitCommit struct {
+	Hash    string    `json:"commit"`
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+}
+
+// historyPoint records the dependency graph at a commit.
+type historyPoint struct {
+	gitCommit
+	Modules int      `json:"modules"`
+	Depth   int      `json:"depth"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// Diagnostics records any problems found in the output of go mod graph.
+	Diagnostics *diagnostics `json:"diagnostics,omitempty"`
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run `git %v`: %v: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()), err)
+	}
+	return output, nil
+}
+
+// gitLog returns the commits, oldest first, reported by git log for the
+// supplied arguments.
+func gitLog(ctx context.Context, dir string, args ...string) ([]gitCommit, error) {
+	output, err := gitOutput(ctx, dir, append([]string{"log", "--reverse", "--format=%H %ct %s"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	commits := []gitCommit{}
+	sc := bufio.NewScanner(bytes.NewBuffer(output))
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), " ", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		secs, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the output of git log: %q: %v", sc.Text(), err)
+		}
+		c := gitCommit{Hash: parts[0], Time: time.Unix(secs, 0).UTC()}
+		if len(parts) == 3 {
+			c.Subject = parts[2]
+		}
+		commits = append(commits, c)
+	}
+	return commits, sc.Err()
+}
+
+// moduleCommits returns the commits, oldest first, that changed the
+// go.mod or go.sum files in dir since the specified revision, which is
+// itself included, or since the first commit if since is empty.
+func moduleCommits(ctx context.Context, dir, gomod, gosum, since string) ([]gitCommit, error) {
+	files := []string{"--", filepath.Base(gomod), filepath.Base(gosum)}
+	if len(since) == 0 {
+		return gitLog(ctx, dir, files...)
+	}
+	first, err := gitLog(ctx, dir, "-n", "1", since)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := gitLog(ctx, dir, append([]string{since + "..HEAD"}, files...)...)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, rest...), nil
+}
+
+// everyNth returns every nth commit, always including the first and
+// the last.
+func everyNth(commits []gitCommit, n int) []gitCommit {
+	if n <= 1 || len(commits) == 0 {
+		return commits
+	}
+	selected := []gitCommit{}
+	for i := 0; i < len(commits); i += n {
+		selected = append(selected, commits[i])
+	}
+	if (len(commits)-1)%n != 0 {
+		selected = append(selected, commits[len(commits)-1])
+	}
+	return selected
+}
+
+// depth returns the length of the longest of the shortest paths from
+// root to any other module.
+func (gr *graph) depth(root string) int {
+	gn := gr.nodes[root]
+	if gn == nil {
+		return 0
+	}
+	distance := map[string]int{root: 0}
+	queue := []*graphNode{gn}
+	depth := 0
+	for len(queue) > 0 {
+		gn := queue[0]
+		queue = queue[1:]
+		for _, dep := range gn.dependencies {
+			if _, ok := distance[dep.module]; ok || isPseudoModule(dep.module) {
+				continue
+			}
+			distance[dep.module] = distance[gn.module] + 1
+			if distance[dep.module] > depth {
+				depth = distance[dep.module]
+			}
+			queue = append(queue, dep)
+		}
+	}
+	return depth
+}
+
+// commitSnapshot returns the dependency graph, and the main module, for
+// the go.mod and go.sum files in dir at the specified commit.
+func commitSnapshot(ctx context.Context, dir, gomod, gosum string, c gitCommit) (*graphSnapshot, string, error) {
+	modBuf, err := gitOutput(ctx, dir, "show", c.Hash+":./"+filepath.Base(gomod))
+	if err != nil {
+		return nil, "", err
+	}
+	// go.sum may not exist at every commit.
+	sumBuf, _ := gitOutput(ctx, dir, "show", c.Hash+":./"+filepath.Base(gosum))
+	tmpdir, err := ioutil.TempDir("", "gomodgraph-history-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmpdir)
+	if err := writeModule(gomod, modBuf, sumBuf, tmpdir); err != nil {
+		return nil, "", err
+	}
+	snapshot, err := loadSnapshot(ctx, goCmd{Dir: tmpdir, Env: offlineEnv()})
+	if err != nil {
+		return nil, "", err
+	}
+	return snapshot, modfile.ModulePath(modBuf), nil
+}
+
+// loadHistory returns the main module and the dependency graph at each of
+// the commits that changed the go.mod or go.sum files since the specified
+// revision, analyzing only every nth such commit.
+func loadHistory(ctx context.Context, since string, every int) (string, []historyPoint, error) {
+	gomod, gosum, err := getGoMod(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	buf, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Dir(gomod)
+	commits, err := moduleCommits(ctx, dir, gomod, gosum, since)
+	if err != nil {
+		return "", nil, err
+	}
+	points := []historyPoint{}
+	var previous *graphSnapshot
+	for _, c := range everyNth(commits, every) {
+		pt := historyPoint{gitCommit: c}
+		snapshot, root, err := commitSnapshot(ctx, dir, gomod, gosum, c)
+		if err != nil {
+			pt.Error = err.Error()
+			points = append(points, pt)
+			continue
+		}
+		for m := range snapshot.graph.nodes {
+			if m != root && !isPseudoModule(m) {
+				pt.Modules++
+			}
+		}
+		pt.Depth = snapshot.graph.depth(root)
+		pt.Diagnostics = snapshot.diagnostics.orNil()
+		if previous != nil {
+			diff := diffSnapshots(previous, snapshot)
+			pt.Added, pt.Removed = diff.Added, diff.Removed
+		}
+		previous = snapshot
+		points = append(points, pt)
+	}
+	return modfile.ModulePath(buf), points, nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func writeHistoryText(out io.Writer, points []historyPoint) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "commit\tdate\tmodules\tdepth\tchanges\n")
+	for _, pt := range points {
+		if len(pt.Error) > 0 {
+			fmt.Fprintf(tw, "%v\t%v\t-\t-\terror: %v\n", shortHash(pt.Hash), pt.Time.Format("2006-01-02"), strings.SplitN(pt.Error, "\n", 2)[0])
+			continue
+		}
+		changes := make([]string, 0, len(pt.Added)+len(pt.Removed))
+		for _, m := range pt.Added {
+			changes = append(changes, "+"+m)
+		}
+		for _, m := range pt.Removed {
+			changes = append(changes, "-"+m)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", shortHash(pt.Hash), pt.Time.Format("2006-01-02"), pt.Modules, pt.Depth, strings.Join(changes, " "))
+	}
+	return tw.Flush()
+}
+
+// historyChart is an svg line chart of the module count and depth, each
+// scaled to the height of the chart.
+type historyChart struct {
+	Width, Height        float64
+	Left, Right          float64
+	Top, Bottom          float64
+	MaxModules, MaxDepth int
+	Modules, Depth       string // svg polyline points.
+	Points               []historyChartPoint
+}
+
+type historyChartPoint struct {
+	X, ModulesY, DepthY float64
+	Title               string
+}
+
+const historyChartMargin = 40
+
+func newHistoryChart(points []historyPoint) *historyChart {
+	hc := &historyChart{Width: 800, Height: 300}
+	hc.Left, hc.Right = historyChartMargin, hc.Width-historyChartMargin
+	hc.Top, hc.Bottom = historyChartMargin/2, hc.Height-historyChartMargin
+	valid := []historyPoint{}
+	for _, pt := range points {
+		if len(pt.Error) > 0 {
+			continue
+		}
+		valid = append(valid, pt)
+		if pt.Modules > hc.MaxModules {
+			hc.MaxModules = pt.Modules
+		}
+		if pt.Depth > hc.MaxDepth {
+			hc.MaxDepth = pt.Depth
+		}
+	}
+	y := func(v, max int) float64 {
+		if max == 0 {
+			return hc.Bottom
+		}
+		return hc.Bottom - float64(v)/float64(max)*(hc.Bottom-hc.Top)
+	}
+	modules, depth := []string{}, []string{}
+	for i, pt := range valid {
+		x := (hc.Left + hc.Right) / 2
+		if len(valid) > 1 {
+			x = hc.Left + float64(i)*(hc.Right-hc.Left)/float64(len(valid)-1)
+		}
+		cp := historyChartPoint{
+			X:        x,
+			ModulesY: y(pt.Modules, hc.MaxModules),
+			DepthY:   y(pt.Depth, hc.MaxDepth),
+			Title: fmt.Sprintf("%v %v\n%v\nmodules: %v, depth: %v, added: %v, removed: %v",
+				shortHash(pt.Hash), pt.Time.Format("2006-01-02"), pt.Subject, pt.Modules, pt.Depth, len(pt.Added), len(pt.Removed)),
+		}
+		hc.Points = append(hc.Points, cp)
+		modules = append(modules, fmt.Sprintf("%.1f,%.1f", cp.X, cp.ModulesY))
+		depth = append(depth, fmt.Sprintf("%.1f,%.1f", cp.X, cp.DepthY))
+	}
+	hc.Modules, hc.Depth = strings.Join(modules, " "), strings.Join(depth, " ")
+	return hc
+}
+
+func writeHistoryHTML(out io.Writer, root string, points []historyPoint) error {
+	data := struct {
+		Root   string
+		Chart  *historyChart
+		Points []historyPoint
+	}{
+		Root:   root,
+		Chart:  newHistoryChart(points),
+		Points: points,
+	}
+	return historyTmpl.Execute(out, &data)
+}
+
+func graphHistory(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	out := cmd.OutOrStdout()
+	var write func(root string, points []historyPoint) error
+	switch graphState.HistoryFormat {
+	case "text":
+		write = func(root string, points []historyPoint) error {
+			return writeHistoryText(out, points)
+		}
+	case "json":
+		write = func(root string, points []historyPoint) error {
+			buf, err := json.MarshalIndent(points, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(append(buf, '\n'))
+			return err
+		}
+	case "html":
+		write = func(root string, points []historyPoint) error {
+			return writeHistoryHTML(out, root, points)
+		}
+	default:
+		return fmt.Errorf("unsupported output format %q, use text, json or html", graphState.HistoryFormat)
+	}
+	root, points, err := loadHistory(ctx, graphState.HistorySince, graphState.HistoryEvery)
+	if err != nil {
+		return err
+	}
+	return write(root, points)
+}
+
+var historyTmpl = template.Must(template.New("history").Funcs(template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("2006-01-02") },
+	"short": shortHash,
+}).Parse(`<!DOCTYPE html>
+<meta charset="utf-8">
+<title>Dependency history of {{.Root}}</title>
+<style type="text/css">
+body {
+  font-family: sans-serif;
+  margin: 2em;
+}
+table {
+  border-collapse: collapse;
+}
+th, td {
+  padding: 2px 12px;
+  text-align: left;
+  vertical-align: top;
+}
+tr:nth-child(even) {
+  background-color: #EEE;
+}
+td.number {
+  text-align: right;
+}
+.warning {
+  color: #D62728;
+}
+</style>
+<body>
+<h1>Dependency history of {{.Root}}</h1>
+{{- with .Chart}}
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" font-size="12">
+<line x1="{{.Left}}" y1="{{.Bottom}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#999999"/>
+<line x1="{{.Left}}" y1="{{.Top}}" x2="{{.Left}}" y2="{{.Bottom}}" stroke="#1F77B4"/>
+<line x1="{{.Right}}" y1="{{.Top}}" x2="{{.Right}}" y2="{{.Bottom}}" stroke="#E94762"/>
+<text x="{{.Left}}" y="{{.Top}}" dx="-4" text-anchor="end" fill="#1F77B4">{{.MaxModules}}</text>
+<text x="{{.Right}}" y="{{.Top}}" dx="4" fill="#E94762">{{.MaxDepth}}</text>
+<text x="{{.Left}}" y="{{.Bottom}}" dx="-4" text-anchor="end">0</text>
+<text x="{{.Left}}" y="{{.Bottom}}" dy="20" fill="#1F77B4">modules</text>
+<text x="{{.Right}}" y="{{.Bottom}}" dy="20" text-anchor="end" fill="#E94762">depth</text>
+<polyline points="{{.Modules}}" fill="none" stroke="#1F77B4" stroke-width="2"/>
+<polyline points="{{.Depth}}" fill="none" stroke="#E94762" stroke-width="2"/>
+{{- range .Points}}
+<g><title>{{.Title}}</title><circle cx="{{.X}}" cy="{{.ModulesY}}" r="4" fill="#1F77B4"/><circle cx="{{.X}}" cy="{{.DepthY}}" r="4" fill="#E94762"/></g>
+{{- end}}
+</svg>
+{{- end}}
+<table>
+<tr><th>commit</th><th>date</th><th>subject</th><th>modules</th><th>depth</th><th>added</th><th>removed</th></tr>
+{{- range .Points}}
+{{- if .Error}}
+<tr><td>{{short .Hash}}</td><td>{{date .Time}}</td><td>{{.Subject}}</td><td colspan="4" class="warning">{{.Error}}</td></tr>
+{{- else}}
+<tr><td>{{short .Hash}}</td><td>{{date .Time}}</td><td>{{.Subject}}</td><td class="number">{{.Modules}}</td><td class="number">{{.Depth}}</td><td>{{range .Added}}{{.}}<br>{{end}}</td><td>{{range .Removed}}{{.}}<br>{{end}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,53 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHistoryDepth(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		depth   int
+	}{
+		{"small", 1},
+		{"cyclic", 2},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		gr, _ := fx.graph(t, false)
+		if got, want := gr.depth(fx.root), tc.depth; got != want {
+			t.Errorf("%v: got %v, want %v", tc.fixture, got, want)
+		}
+	}
+}
+
+func TestEveryNth(t *testing.T) {
+	commits := []gitCommit{}
+	for _, h := range strings.Split("abcdefg", "") {
+		commits = append(commits, gitCommit{Hash: h})
+	}
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "abcdefg"},
+		{1, "abcdefg"},
+		{2, "aceg"},
+		{3, "adg"},
+		{4, "aeg"},
+		{10, "ag"},
+	} {
+		got := []string{}
+		for _, c := range everyNth(commits, tc.n) {
+			got = append(got, c.Hash)
+		}
+		if want := strings.Split(tc.want, ""); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", tc.n, got, want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/modfile"
+)
+
+var graphUpgradeImpactCmd = &cobra.Command{
+	Use:   "upgrade-impact <module>@<version>",
+	Short: "report how the dependency graph would change if a module were upgraded",
+	Long: `report how the dependency graph would change if a module were upgraded
+(or downgraded). The go.mod and go.sum files for the current module are
+copied to a temporary directory and go get is run there, using only the
+local module cache (ie. GOPROXY=off), so that the current module is never
+modified. The resulting graph is compared to the current one and any new
+modules, removed modules, version changes and newly introduced cycles are
+reported.`,
+	Args: cobra.ExactArgs(1),
+	RunE: graphUpgradeImpact,
+}
+
+func init() {
+	graphCmd.AddCommand(graphUpgradeImpactCmd)
+}
+
+// graphSnapshot is the unversioned dependency graph, the versions
+// selected by minimal version selection and the problems found in the
+// output of go mod graph for a module.
+type graphSnapshot struct {
+	graph       *graph
+	selected    map[string]string
+	diagnostics *diagnostics
+}
+
+func loadSnapshot(ctx context.Context, gc goCmd) (*graphSnapshot, error) {
+	raw, diag, err := getModGraph(ctx, gc)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := getSelectedVersions(ctx, gc)
+	if err != nil {
+		return nil, err
+	}
+	dependencies, unique, _ := processGraph(raw, false)
+	graph, err := buildGraph(dependencies, unique, diag)
+	if err != nil {
+		return nil, err
+	}
+	return &graphSnapshot{graph: graph, selected: selected, diagnostics: diag}, nil
+}
+
+type versionChange struct {
+	Module   string
+	From, To string
+}
+
+// graphDiff records the differences between two snapshots.
+type graphDiff struct {
+	Added     []string
+	Removed   []string
+	Changed   []versionChange
+	NewCycles [][]string
+}
+
+func diffSnapshots(before, after *graphSnapshot) *graphDiff {
+	diff := &graphDiff{}
+	for m := range after.graph.nodes {
+		if isPseudoModule(m) {
+			continue
+		}
+		if _, ok := before.graph.nodes[m]; !ok {
+			diff.Added = append(diff.Added, m)
+			continue
+		}
+		if from, to := before.selected[m], after.selected[m]; from != to {
+			diff.Changed = append(diff.Changed, versionChange{Module: m, From: from, To: to})
+		}
+	}
+	for m := range before.graph.nodes {
+		if isPseudoModule(m) {
+			continue
+		}
+		if _, ok := after.graph.nodes[m]; !ok {
+			diff.Removed = append(diff.Removed, m)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Module < diff.Changed[j].Module
+	})
+	existing := map[string]bool{}
+	for _, c := range before.graph.cycles() {
+		existing[strings.Join(c, " ")] = true
+	}
+	for _, c := range after.graph.cycles() {
+		if !existing[strings.Join(c, " ")] {
+			diff.NewCycles = append(diff.NewCycles, c)
+		}
+	}
+	return diff
+}
+
+func (diff *graphDiff) print(out io.Writer, selected map[string]string) {
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed)+len(diff.NewCycles) == 0 {
+		fmt.Fprintf(out, "no changes\n")
+		return
+	}
+	if len(diff.Added) > 0 {
+		fmt.Fprintf(out, "new modules (%v):\n", len(diff.Added))
+		for _, m := range diff.Added {
+			fmt.Fprintf(out, "  %v %v\n", m, selected[m])
+		}
+	}
+	if len(diff.Removed) > 0 {
+		fmt.Fprintf(out, "removed modules (%v):\n", len(diff.Removed))
+		for _, m := range diff.Removed {
+			fmt.Fprintf(out, "  %v\n", m)
+		}
+	}
+	if len(diff.Changed) > 0 {
+		fmt.Fprintf(out, "version changes (%v):\n", len(diff.Changed))
+		for _, c := range diff.Changed {
+			fmt.Fprintf(out, "  %v %v -> %v\n", c.Module, c.From, c.To)
+		}
+	}
+	if len(diff.NewCycles) > 0 {
+		fmt.Fprintf(out, "new cycles (%v):\n", len(diff.NewCycles))
+		for _, c := range diff.NewCycles {
+			fmt.Fprintf(out, "  %v\n", strings.Join(c, ", "))
+		}
+	}
+}
+
+// offlineEnv returns the environment used to run go commands for copies
+// of a module, it ensures that only the local module cache is used. The
+// ambient GOFLAGS, --goflags and --tags still apply, --modfile does not
+// since the copy is made from the file it specifies.
+func offlineEnv() []string {
+	flags := append(goFlags(false), "-mod=mod")
+	return []string{"GOPROXY=off", "GOFLAGS=" + strings.Join(flags, " "), "GOWORK=off"}
+}
+
+// copyModule copies the go.mod and go.sum files for the module to dir,
+// rewriting any relative local replace directives so that they continue
+// to refer to the same directories.
+func copyModule(gomod, gosum, dir string) error {
+	modBuf, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	sumBuf, err := ioutil.ReadFile(gosum)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeModule(gomod, modBuf, sumBuf, dir)
+}
+
+// writeModule writes the supplied contents of the go.mod file gomod, and
+// of its go.sum file if not nil, to dir, rewriting any relative local
+// replace directives to be relative to the directory containing gomod.
+func writeModule(gomod string, modBuf, sumBuf []byte, dir string) error {
+	f, err := modfile.Parse(gomod, modBuf, nil)
+	if err != nil {
+		return err
+	}
+	moddir := filepath.Dir(gomod)
+	for _, r := range f.Replace {
+		if len(r.New.Version) > 0 || filepath.IsAbs(r.New.Path) {
+			continue
+		}
+		if err := f.AddReplace(r.Old.Path, r.Old.Version, filepath.Join(moddir, r.New.Path), ""); err != nil {
+			return err
+		}
+	}
+	buf, err := f.Format()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), buf, 0600); err != nil {
+		return err
+	}
+	if sumBuf == nil {
+		return nil
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "go.sum"), sumBuf, 0600)
+}
+
+func graphUpgradeImpact(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	if !strings.Contains(args[0], "@") {
+		return fmt.Errorf("%v: must be of the form <module>@<version>", args[0])
+	}
+	gomod, gosum, err := getGoMod(ctx)
+	if err != nil {
+		return err
+	}
+	before, err := loadSnapshot(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	moduleDiagnostics = before.diagnostics
+	dir, err := ioutil.TempDir("", "gomodgraph-upgrade-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := copyModule(gomod, gosum, dir); err != nil {
+		return err
+	}
+	scratch := goCmd{Dir: dir, Env: offlineEnv()}
+	if _, err := scratch.output(ctx, "get", args[0]); err != nil {
+		return err
+	}
+	after, err := loadSnapshot(ctx, scratch)
+	if err != nil {
+		return err
+	}
+	if !after.diagnostics.empty() {
+		fmt.Fprintf(cmd.ErrOrStderr(), "after upgrading to %v:\n", args[0])
+		after.diagnostics.summary(cmd.ErrOrStderr())
+	}
+	diffSnapshots(before, after).print(cmd.OutOrStdout(), after.selected)
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+func TestOfflineEnv(t *testing.T) {
+	saved := graphState
+	defer func() { graphState = saved }()
+	t.Setenv("GOFLAGS", "-trimpath")
+	graphState = graphStateDef{GoFlags: "-mod=readonly", Tags: "a,b", ModFile: "tools.mod"}
+	if got, want := offlineEnv(), []string{"GOPROXY=off", "GOFLAGS=-trimpath -mod=readonly -tags=a,b -mod=mod", "GOWORK=off"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	t.Setenv("GOFLAGS", "")
+	graphState = graphStateDef{}
+	if got, want := offlineEnv(), []string{"GOPROXY=off", "GOFLAGS=-mod=mod", "GOWORK=off"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func newSnapshot(t *testing.T, raw []dependency, selected map[string]string) *graphSnapshot {
+	dependencies, unique, _ := processGraph(raw, false)
+	diag := &diagnostics{}
+	gr, err := buildGraph(dependencies, unique, diag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &graphSnapshot{graph: gr, selected: selected, diagnostics: diag}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := newSnapshot(t, []dependency{
+		{Module: "example.com/app", DependsOn: "example.com/a@v1.0.0"},
+		{Module: "example.com/app", DependsOn: "go@1.21"},
+		{Module: "example.com/a@v1.0.0", DependsOn: "example.com/b@v1.0.0"},
+		{Module: "example.com/b@v1.0.0", DependsOn: "example.com/d@v1.0.0"},
+		{Module: "example.com/d@v1.0.0", DependsOn: "example.com/b@v1.0.0"},
+	}, map[string]string{"example.com/a": "v1.0.0", "example.com/b": "v1.0.0", "example.com/d": "v1.0.0"})
+	after := newSnapshot(t, []dependency{
+		{Module: "example.com/app", DependsOn: "example.com/a@v1.2.0"},
+		{Module: "example.com/app", DependsOn: "go@1.22"},
+		{Module: "example.com/a@v1.2.0", DependsOn: "example.com/c@v0.1.0"},
+		{Module: "example.com/a@v1.2.0", DependsOn: "example.com/d@v1.0.0"},
+		{Module: "example.com/c@v0.1.0", DependsOn: "example.com/a@v1.1.0"},
+	}, map[string]string{"example.com/a": "v1.2.0", "example.com/c": "v0.1.0", "example.com/d": "v1.0.0"})
+
+	diff := diffSnapshots(before, after)
+	if got, want := diff, (&graphDiff{
+		Added:     []string{"example.com/c"},
+		Removed:   []string{"example.com/b"},
+		Changed:   []versionChange{{Module: "example.com/a", From: "v1.0.0", To: "v1.2.0"}},
+		NewCycles: [][]string{{"example.com/a", "example.com/c"}},
+	}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+	out := &bytes.Buffer{}
+	diff.print(out, after.selected)
+	if got, want := out.String(), `new modules (1):
+  example.com/c v0.1.0
+removed modules (1):
+  example.com/b
+version changes (1):
+  example.com/a v1.0.0 -> v1.2.0
+new cycles (1):
+  example.com/a, example.com/c
+`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	out.Reset()
+	diffSnapshots(after, after).print(out, after.selected)
+	if got, want := out.String(), "no changes\n"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWriteModule(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	gomod := filepath.Join(src, "app", "go.mod")
+	abs := filepath.Join(src, "abs")
+	modBuf := []byte(`module example.com/app
+
+go 1.21
+
+require (
+	example.com/x v1.0.0
+	example.com/y v1.0.0
+	example.com/abs v1.0.0
+)
+
+replace example.com/x => ../x
+
+replace example.com/y v1.0.0 => example.com/z v1.1.0
+
+replace example.com/abs => ` + abs + `
+`)
+	sumBuf := []byte("example.com/z v1.1.0 h1:x\n")
+	if err := writeModule(gomod, modBuf, sumBuf, dst); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dst, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := modfile.Parse("go.mod", buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced := map[string]string{}
+	for _, r := range f.Replace {
+		replaced[r.Old.String()] = r.New.String()
+	}
+	if got, want := replaced, map[string]string{
+		"example.com/x":        filepath.Join(src, "x"),
+		"example.com/y@v1.0.0": "example.com/z@v1.1.0",
+		"example.com/abs":      abs,
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := f.Module.Mod.Path, "example.com/app"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(dst, "go.sum")); err != nil || !bytes.Equal(got, sumBuf) {
+		t.Errorf("got %s, %v, want %s", got, err, sumBuf)
+	}
+
+	// go.sum is not written if there is none.
+	dst = t.TempDir()
+	if err := writeModule(gomod, modBuf, nil, dst); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "go.sum")); !os.IsNotExist(err) {
+		t.Errorf("unexpected go.sum: %v", err)
+	}
+}
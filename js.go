@@ -11,7 +11,8 @@ const dependencyWheelJS = `d3.chart = d3.chart || {};
  * d3.select('#chart_placeholder')
  *   .datum({
  *      packageNames: [the name of the packages in the matrix],
- *      matrix: [your dependency matrix]
+ *      matrix: [your dependency matrix],
+ *      groups: {count: number of groups, ids: [group index of each package]} or null
  *   })
  *   .call(chart);
  *
@@ -72,8 +73,17 @@ d3.chart.dependencyWheel = function(options) {
         .innerRadius(radius)
         .outerRadius(radius + 20);
 
+      var groups = data.groups;
       var fill = function(d) {
         if (d.index === 0) return '#ccc';
+        if (groups) {
+          // color by group rather than by the first letter of the module.
+          return (
+            'hsl(' +
+            parseInt((groups.ids[d.index] / groups.count) * 360, 10) +
+            ',90%,70%)'
+          );
+        }
         return (
           'hsl(' +
           parseInt(
@@ -294,6 +304,68 @@ displayTree = function(treeData) {
         return d.children && d.children.length > 0 ? d.children : null;
     });
 
+    // Record each node's parent, including for nodes in collapsed
+    // subtrees, so that search results and paths to the root can be
+    // expanded.
+    visit(treeData, function(d) {
+        (d.children || []).forEach(function(c) {
+            c._parent = d;
+        });
+    }, function(d) {
+        return d.children && d.children.length > 0 ? d.children : null;
+    });
+
+    // allChildren returns both visible and collapsed children.
+    function allChildren(d) {
+        var c = (d.children || []).concat(d._children || []);
+        return c.length > 0 ? c : null;
+    }
+
+    function expandAncestors(d) {
+        for (var p = d._parent; p; p = p._parent) {
+            if (p._children) {
+                p.children = p._children;
+                p._children = null;
+            }
+        }
+    }
+
+    // Tooltip with the module's version, cycle information and metadata.
+    function tooltip(d) {
+        var t = d.name;
+        if (d.version) {
+            t += "\nversion: " + d.version;
+        }
+        if (d.cycle.length > 0) {
+            t += "\ncycle -> " + d.cycle;
+        }
+        if (d.usage) {
+            t += "\nusage: " + d.usage;
+        }
+        var md = d.metadata;
+        if (md) {
+            if (md.go_version) {
+                t += "\ngo: " + md.go_version;
+            }
+            if (md.time && md.time.indexOf("0001-") !== 0) {
+                t += "\nreleased: " + md.time.substring(0, 10);
+            }
+            if (md.packages) {
+                t += "\npackages: " + md.packages + ", size: " + md.size;
+            }
+            if (md.deprecated) {
+                t += "\ndeprecated: " + md.deprecated;
+            }
+            if (md.retracted) {
+                t += "\nretracted: " + (md.rationale || "");
+            }
+        }
+        return t;
+    }
+
+    // The most recently clicked node, used for showing the path to the root.
+    var lastClicked = null;
+
     /* Pre-sorted by the calling go code.
     // sort the tree according to the node names
     function sortTree() {
@@ -479,6 +551,7 @@ displayTree = function(treeData) {
 
     function click(d) {
         if (d3.event.defaultPrevented) return; // click suppressed
+        lastClicked = d;
         d = toggleChildren(d);
         update(d);
         centerNode(d);
@@ -528,7 +601,14 @@ displayTree = function(treeData) {
             .attr("transform", function(d) {
                 return "translate(" + source.y0 + "," + source.x0 + ")";
             })
-            .on('click', click);
+            .on('click', click)
+            .on('contextmenu', function(d) {
+                d3.event.preventDefault();
+                pathToRoot(d);
+            });
+
+        nodeEnter.append("title")
+            .text(tooltip);
 
         nodeEnter.append("circle")
             .attr("class", 'nodeCircle')
@@ -586,6 +666,17 @@ displayTree = function(treeData) {
                 return d.name;
             });
 
+        // Highlight search results and the path to the root.
+        node.classed("found", function(d) {
+                return !!d.found;
+            })
+            .classed("onpath", function(d) {
+                return !!d.onPath;
+            })
+            .classed("deprecated", function(d) {
+                return !!d.metadata && (!!d.metadata.deprecated || !!d.metadata.retracted);
+            });
+
         // Change the circle fill depending on whether it has children and is collapsed
         node.select("circle.nodeCircle")
             .attr("r", 4.5)
@@ -641,6 +732,15 @@ displayTree = function(treeData) {
                 });
             });
 
+        link.classed("onpath", function(d) {
+            return !!d.target.onPath;
+        })
+            .classed("test", function(d) {
+                // The dependency is the child in the dependency tree and
+                // the parent in the dependent tree.
+                return (dependencies ? d.target : d.source).usage === "test";
+            });
+
         // Transition links to their new position.
         link.transition()
             .duration(duration)
@@ -679,5 +779,449 @@ displayTree = function(treeData) {
     // Layout the tree initially and center on the root node.
     update(root);
     centerNode(root);
+
+    // search expands and highlights all occurrences of modules whose
+    // name contains the supplied text, returning the number found.
+    function search(text) {
+        var found = [];
+        visit(root, function(d) {
+            d.found = text.length > 0 && d.name.indexOf(text) >= 0;
+            if (d.found) {
+                found.push(d);
+            }
+        }, allChildren);
+        found.forEach(expandAncestors);
+        update(root);
+        if (found.length > 0) {
+            centerNode(found[0]);
+        }
+        return found.length;
+    }
+
+    // pathToRoot highlights the path from the supplied node, or the most
+    // recently clicked one, to the root.
+    function pathToRoot(d) {
+        d = d || lastClicked;
+        visit(root, function(n) {
+            n.onPath = false;
+        }, allChildren);
+        if (!d) return;
+        expandAncestors(d);
+        for (var p = d; p; p = p._parent) {
+            p.onPath = true;
+        }
+        update(root);
+        centerNode(d);
+    }
+
+    return {
+        search: search,
+        pathToRoot: pathToRoot
+    };
+};
+`
+
+// forceJS is a self contained force directed layout that requires no
+// external libraries so that the generated page can be viewed offline.
+// The simulation follows the same model as d3-force, using many body
+// repulsion approximated by a Barnes-Hut quadtree, link springs and a
+// centering force.
+const forceJS = `
+displayForceGraph = function(graph) {
+    var svgns = 'http://www.w3.org/2000/svg';
+    var svg = document.getElementById('graph');
+    var width = svg.clientWidth;
+    var height = svg.clientHeight;
+    var nodes = graph.nodes;
+    var links = graph.links;
+
+    // Transform used for pan/zoom.
+    var view = {x: 0, y: 0, k: 1};
+
+    // Assign each group a color, the root is always the first node.
+    var groupNames = [];
+    var groupIndex = {};
+    nodes.forEach(function(n) {
+        if (!(n.group in groupIndex)) {
+            groupIndex[n.group] = groupNames.length;
+            groupNames.push(n.group);
+        }
+    });
+    function color(n) {
+        if (n.index === 0) return '#E94762';
+        return 'hsl(' + parseInt((groupIndex[n.group] / groupNames.length) * 360, 10) + ',70%,55%)';
+    }
+    var groupSelect = document.getElementById('group');
+    groupNames.slice().sort().forEach(function(g) {
+        var opt = document.createElement('option');
+        opt.value = g;
+        opt.text = g;
+        groupSelect.appendChild(opt);
+    });
+
+    // Initial positions on a phyllotaxis spiral, as per d3-force.
+    nodes.forEach(function(n, i) {
+        var radius = 10 * Math.sqrt(0.5 + i);
+        var angle = i * Math.PI * (3 - Math.sqrt(5));
+        n.index = i;
+        n.x = width / 2 + radius * Math.cos(angle);
+        n.y = height / 2 + radius * Math.sin(angle);
+        n.vx = 0;
+        n.vy = 0;
+        n.dependencies = [];
+        n.dependents = [];
+        n.visible = true;
+    });
+    links.forEach(function(l) {
+        nodes[l.source].dependencies.push(l);
+        nodes[l.target].dependents.push(l);
+    });
+
+    function el(name, attrs, parent) {
+        var e = document.createElementNS(svgns, name);
+        for (var a in attrs) {
+            e.setAttribute(a, attrs[a]);
+        }
+        if (parent) parent.appendChild(e);
+        return e;
+    }
+
+    var defs = el('defs', {}, svg);
+    [['arrow', '#999'], ['arrow-cycle', 'red']].forEach(function(m) {
+        var marker = el('marker', {id: m[0], viewBox: '0 -5 10 10', refX: 18, refY: 0,
+            markerWidth: 6, markerHeight: 6, orient: 'auto'}, defs);
+        el('path', {d: 'M0,-5L10,0L0,5', fill: m[1]}, marker);
+    });
+
+    var container = el('g', {}, svg);
+    var linkLayer = el('g', {}, container);
+    var nodeLayer = el('g', {}, container);
+
+    links.forEach(function(l) {
+        l.el = el('line', {
+            'class': l.cycle ? 'link cycle' : 'link',
+            'marker-end': l.cycle ? 'url(#arrow-cycle)' : 'url(#arrow)'
+        }, linkLayer);
+    });
+    nodes.forEach(function(n) {
+        n.el = el('g', {'class': 'node'}, nodeLayer);
+        n.radius = 4 + Math.sqrt(n.dependents.length);
+        el('circle', {r: n.radius, fill: color(n)}, n.el);
+        var title = el('title', {}, n.el);
+        title.textContent = n.name + ' (' + n.group + ')\n' +
+            n.dependencies.length + ' dependencies, ' + n.dependents.length + ' dependents';
+        var label = el('text', {x: n.radius + 2, dy: '.35em'}, n.el);
+        label.textContent = n.name;
+        n.el.addEventListener('mouseover', function() { highlight(n); });
+        n.el.addEventListener('mouseout', function() { highlight(null); });
+        n.el.addEventListener('mousedown', function(e) { startDrag(e, n); });
+    });
+
+    // Highlight a node's dependencies and dependents.
+    function highlight(n) {
+        var related = {};
+        if (n) {
+            related[n.index] = true;
+            n.dependencies.forEach(function(l) { related[l.target] = true; });
+            n.dependents.forEach(function(l) { related[l.source] = true; });
+        }
+        nodes.forEach(function(m) {
+            m.el.classList.toggle('faded', n !== null && !related[m.index]);
+        });
+        links.forEach(function(l) {
+            var dep = n !== null && l.source === n.index;
+            var rdep = n !== null && l.target === n.index;
+            l.el.classList.toggle('dependency', dep);
+            l.el.classList.toggle('dependent', rdep);
+            l.el.classList.toggle('faded', n !== null && !dep && !rdep);
+        });
+    }
+
+    // Search for modules whose name contains the search text.
+    var status = document.getElementById('status');
+    var search = document.getElementById('search');
+    var matches = [];
+    search.addEventListener('input', function() {
+        var text = search.value.trim();
+        matches = [];
+        nodes.forEach(function(n) {
+            var matched = text.length > 0 && n.visible && n.name.indexOf(text) >= 0;
+            n.el.classList.toggle('matched', matched);
+            if (matched) matches.push(n);
+        });
+        status.textContent = text.length > 0 ? matches.length + ' matches' : '';
+    });
+    search.addEventListener('keydown', function(e) {
+        if (e.key === 'Enter' && matches.length > 0) {
+            // cycle through the matches, centering on each in turn.
+            var n = matches.shift();
+            matches.push(n);
+            view.x = width / 2 - n.x * view.k;
+            view.y = height / 2 - n.y * view.k;
+            render();
+            highlight(n);
+        }
+    });
+
+    // Filter by group, a link is displayed only if both ends are.
+    groupSelect.addEventListener('change', function() {
+        var group = groupSelect.value;
+        nodes.forEach(function(n) {
+            n.visible = group === '' || n.group === group;
+            n.el.style.display = n.visible ? null : 'none';
+        });
+        links.forEach(function(l) {
+            var visible = nodes[l.source].visible && nodes[l.target].visible;
+            l.el.style.display = visible ? null : 'none';
+        });
+    });
+
+    // Pan, zoom and drag.
+    var dragging = null;
+    var panning = null;
+    function startDrag(e, n) {
+        e.stopPropagation();
+        dragging = n;
+        n.fx = n.x;
+        n.fy = n.y;
+        reheat(0.3);
+    }
+    svg.addEventListener('mousedown', function(e) {
+        panning = {x: e.clientX - view.x, y: e.clientY - view.y};
+    });
+    window.addEventListener('mousemove', function(e) {
+        if (dragging) {
+            dragging.fx = (e.clientX - view.x) / view.k;
+            dragging.fy = (e.clientY - view.y) / view.k;
+            reheat(0.3);
+        } else if (panning) {
+            view.x = e.clientX - panning.x;
+            view.y = e.clientY - panning.y;
+            render();
+        }
+    });
+    window.addEventListener('mouseup', function() {
+        if (dragging) {
+            dragging.fx = null;
+            dragging.fy = null;
+        }
+        dragging = null;
+        panning = null;
+    });
+    svg.addEventListener('wheel', function(e) {
+        e.preventDefault();
+        var k = Math.max(0.05, Math.min(8, view.k * Math.pow(2, -e.deltaY / 500)));
+        view.x = e.clientX - (e.clientX - view.x) * k / view.k;
+        view.y = e.clientY - (e.clientY - view.y) * k / view.k;
+        view.k = k;
+        render();
+    });
+
+    // The simulation.
+    var alpha = 1;
+    var alphaMin = 0.001;
+    var alphaDecay = 1 - Math.pow(alphaMin, 1 / 300);
+    var velocityDecay = 0.6;
+    var charge = -60;
+    var linkDistance = 40;
+    var running = false;
+    // theta2 is the square of the Barnes-Hut accuracy parameter, quads
+    // that are further away than their size / theta are approximated by
+    // their center.
+    var theta2 = 0.81;
+
+    // quadtree returns a Barnes-Hut quadtree of the current node positions
+    // so that the many body force can be computed in O(n log n) rather than
+    // O(n^2) per tick. Each quad records the number of nodes within it and
+    // their center, leaves record the nodes themselves.
+    function quadtree() {
+        var x0 = Infinity, y0 = Infinity, x1 = -Infinity, y1 = -Infinity;
+        nodes.forEach(function(n) {
+            x0 = Math.min(x0, n.x);
+            y0 = Math.min(y0, n.y);
+            x1 = Math.max(x1, n.x);
+            y1 = Math.max(y1, n.y);
+        });
+        var root = {x0: x0, y0: y0, size: Math.max(x1 - x0, y1 - y0, 1)};
+        nodes.forEach(function(n) {
+            insert(root, n, 0);
+        });
+        accumulate(root);
+        return root;
+    }
+
+    function insert(q, n, depth) {
+        if (q.children) {
+            insertChild(q, n, depth);
+            return;
+        }
+        if (!q.points) {
+            q.points = [n];
+            return;
+        }
+        // Coincident nodes share a leaf, as do nodes that are too close
+        // to be separated.
+        if (depth > 32 || (q.points[0].x === n.x && q.points[0].y === n.y)) {
+            q.points.push(n);
+            return;
+        }
+        var points = q.points;
+        q.points = null;
+        q.children = [null, null, null, null];
+        points.forEach(function(p) {
+            insertChild(q, p, depth);
+        });
+        insertChild(q, n, depth);
+    }
+
+    function insertChild(q, n, depth) {
+        var half = q.size / 2;
+        var right = n.x >= q.x0 + half;
+        var below = n.y >= q.y0 + half;
+        var i = (below ? 2 : 0) + (right ? 1 : 0);
+        if (!q.children[i]) {
+            q.children[i] = {
+                x0: right ? q.x0 + half : q.x0,
+                y0: below ? q.y0 + half : q.y0,
+                size: half
+            };
+        }
+        insert(q.children[i], n, depth + 1);
+    }
+
+    function accumulate(q) {
+        q.count = 0;
+        q.x = 0;
+        q.y = 0;
+        if (q.children) {
+            q.children.forEach(function(c) {
+                if (!c) return;
+                accumulate(c);
+                q.count += c.count;
+                q.x += c.x * c.count;
+                q.y += c.y * c.count;
+            });
+        } else {
+            q.points.forEach(function(p) {
+                q.count++;
+                q.x += p.x;
+                q.y += p.y;
+            });
+        }
+        q.x /= q.count;
+        q.y /= q.count;
+    }
+
+    // repel applies the many body force exerted on n by the nodes in q.
+    function repel(q, n) {
+        if (q.children) {
+            var dx = q.x - n.x;
+            var dy = q.y - n.y;
+            var d2 = dx * dx + dy * dy;
+            if (q.size * q.size < theta2 * d2) {
+                var w = charge * q.count * alpha / Math.max(d2, 1);
+                n.vx += dx * w;
+                n.vy += dy * w;
+                return;
+            }
+            q.children.forEach(function(c) {
+                if (c) repel(c, n);
+            });
+            return;
+        }
+        q.points.forEach(function(p) {
+            if (p === n) return;
+            var dx = p.x - n.x || 1e-6 * (Math.random() - 0.5);
+            var dy = p.y - n.y || 1e-6 * (Math.random() - 0.5);
+            var d2 = Math.max(dx * dx + dy * dy, 1);
+            var w = charge * alpha / d2;
+            n.vx += dx * w;
+            n.vy += dy * w;
+        });
+    }
+
+    function tick() {
+        alpha += (0 - alpha) * alphaDecay;
+        // many body repulsion.
+        var tree = quadtree();
+        nodes.forEach(function(n) {
+            repel(tree, n);
+        });
+        // link springs.
+        links.forEach(function(l) {
+            var s = nodes[l.source];
+            var t = nodes[l.target];
+            var ns = s.dependencies.length + s.dependents.length;
+            var nt = t.dependencies.length + t.dependents.length;
+            var dx = t.x + t.vx - s.x - s.vx || 1e-6;
+            var dy = t.y + t.vy - s.y - s.vy || 1e-6;
+            var l2 = Math.sqrt(dx * dx + dy * dy);
+            var f = (l2 - linkDistance) / l2 * alpha / Math.min(ns, nt);
+            var bias = ns / (ns + nt);
+            dx *= f;
+            dy *= f;
+            t.vx -= dx * bias;
+            t.vy -= dy * bias;
+            s.vx += dx * (1 - bias);
+            s.vy += dy * (1 - bias);
+        });
+        // integrate and center.
+        var cx = 0;
+        var cy = 0;
+        nodes.forEach(function(n) {
+            if (n.fx != null) {
+                n.x = n.fx;
+                n.y = n.fy;
+                n.vx = 0;
+                n.vy = 0;
+            } else {
+                n.x += n.vx *= velocityDecay;
+                n.y += n.vy *= velocityDecay;
+            }
+            cx += n.x;
+            cy += n.y;
+        });
+        cx = cx / nodes.length - width / 2;
+        cy = cy / nodes.length - height / 2;
+        nodes.forEach(function(n) {
+            n.x -= cx;
+            n.y -= cy;
+        });
+    }
+
+    function render() {
+        container.setAttribute('transform', 'translate(' + view.x + ',' + view.y + ')scale(' + view.k + ')');
+        links.forEach(function(l) {
+            var s = nodes[l.source];
+            var t = nodes[l.target];
+            l.el.setAttribute('x1', s.x);
+            l.el.setAttribute('y1', s.y);
+            l.el.setAttribute('x2', t.x);
+            l.el.setAttribute('y2', t.y);
+        });
+        nodes.forEach(function(n) {
+            n.el.setAttribute('transform', 'translate(' + n.x + ',' + n.y + ')');
+        });
+    }
+
+    function step() {
+        tick();
+        render();
+        if (alpha < alphaMin) {
+            running = false;
+            return;
+        }
+        window.requestAnimationFrame(step);
+    }
+
+    function reheat(a) {
+        alpha = Math.max(alpha, a);
+        if (!running) {
+            running = true;
+            window.requestAnimationFrame(step);
+        }
+    }
+
+    reheat(1);
 };
 `
@@ -0,0 +1,356 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+)
+
+const (
+	layoutCharWidth    = 7
+	layoutNodeHeight   = 20
+	layoutNodePadding  = 10
+	layoutNodeGap      = 20
+	layoutLayerSpacing = 80
+	layoutMargin       = 20
+	layoutSweeps       = 12
+)
+
+// layoutNode is a node in a layered layout, dummy nodes are introduced
+// for edges that span more than one layer and have an empty module.
+type layoutNode struct {
+	module string
+	layer  int
+	order  int
+	x, y   float64
+	width  float64
+	up     []int // nodes in the previous layer that are connected to this one.
+	down   []int // nodes in the next layer that are connected to this one.
+}
+
+type layoutPoint struct {
+	X, Y float64
+}
+
+// layoutEdge is an edge in the original graph, drawn as a polyline
+// through points.
+type layoutEdge struct {
+	dependency
+	cycle  bool
+	points []layoutPoint
+}
+
+// layeredLayout is a layered, or Sugiyama style, layout of a directed
+// graph. Cycles are broken by reversing edges, nodes are assigned to
+// layers using the longest path from the sources, crossings are reduced
+// using the barycenter heuristic and finally coordinates are assigned
+// by repeatedly moving nodes towards the average of their neighbours.
+type layeredLayout struct {
+	nodes  []*layoutNode
+	layers [][]int
+	edges  []layoutEdge
+	width  float64
+	height float64
+}
+
+// newLayeredLayout lays out the supplied dependencies. Modules are
+// considered in the order supplied with the first being the root.
+func newLayeredLayout(dependencies []dependency, ordered []string) *layeredLayout {
+	ll := &layeredLayout{}
+	index := make(map[string]int, len(ordered))
+	for i, m := range ordered {
+		index[m] = i
+		ll.nodes = append(ll.nodes, &layoutNode{
+			module: m,
+			width:  float64(len(m)*layoutCharWidth + 2*layoutNodePadding),
+		})
+	}
+	n := len(ordered)
+	adj := make([][]int, n)
+	seen := map[[2]int]bool{}
+	for _, dep := range dependencies {
+		e := [2]int{index[dep.Module], index[dep.DependsOn]}
+		if e[0] != e[1] && !seen[e] {
+			seen[e] = true
+			adj[e[0]] = append(adj[e[0]], e[1])
+		}
+	}
+	reversed := breakCycles(adj)
+	acyclic := make([][]int, n)
+	for from, tos := range adj {
+		for _, to := range tos {
+			if reversed[[2]int{from, to}] {
+				acyclic[to] = append(acyclic[to], from)
+				continue
+			}
+			acyclic[from] = append(acyclic[from], to)
+		}
+	}
+	ll.assignLayers(acyclic)
+
+	// Add dummy nodes for edges that span multiple layers and record the
+	// path, in the original edge direction, taken by each edge.
+	paths := map[[2]int][]int{}
+	for from, tos := range adj {
+		for _, to := range tos {
+			top, bottom := from, to
+			if reversed[[2]int{from, to}] {
+				top, bottom = to, from
+			}
+			path := []int{top}
+			for l := ll.nodes[top].layer + 1; l < ll.nodes[bottom].layer; l++ {
+				ll.nodes = append(ll.nodes, &layoutNode{layer: l})
+				dummy := len(ll.nodes) - 1
+				ll.link(path[len(path)-1], dummy)
+				path = append(path, dummy)
+			}
+			ll.link(path[len(path)-1], bottom)
+			path = append(path, bottom)
+			if top != from {
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+			}
+			paths[[2]int{from, to}] = path
+		}
+	}
+
+	nlayers := 0
+	for _, nd := range ll.nodes {
+		if nd.layer+1 > nlayers {
+			nlayers = nd.layer + 1
+		}
+	}
+	ll.layers = make([][]int, nlayers)
+	for i, nd := range ll.nodes {
+		ll.layers[nd.layer] = append(ll.layers[nd.layer], i)
+	}
+	ll.orderLayers()
+	ll.assignCoordinates()
+
+	for _, dep := range dependencies {
+		path := paths[[2]int{index[dep.Module], index[dep.DependsOn]}]
+		if len(path) == 0 {
+			continue
+		}
+		le := layoutEdge{dependency: dep}
+		for _, p := range path {
+			le.points = append(le.points, layoutPoint{X: ll.nodes[p].x, Y: ll.nodes[p].y})
+		}
+		// Start and end the edge on the boundaries of the real nodes.
+		first, last := &le.points[0], &le.points[len(le.points)-1]
+		if le.points[1].Y > first.Y {
+			first.Y += layoutNodeHeight / 2
+			last.Y -= layoutNodeHeight / 2
+		} else {
+			first.Y -= layoutNodeHeight / 2
+			last.Y += layoutNodeHeight / 2
+		}
+		ll.edges = append(ll.edges, le)
+	}
+	return ll
+}
+
+func (ll *layeredLayout) link(from, to int) {
+	ll.nodes[from].down = append(ll.nodes[from].down, to)
+	ll.nodes[to].up = append(ll.nodes[to].up, from)
+}
+
+// breakCycles returns the set of edges that must be reversed to make the
+// graph acyclic, namely the back edges found by a depth first search
+// that starts from each node in turn.
+func breakCycles(adj [][]int) map[[2]int]bool {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make([]int, len(adj))
+	reversed := map[[2]int]bool{}
+	var visit func(n int)
+	visit = func(n int) {
+		state[n] = active
+		for _, m := range adj[n] {
+			switch state[m] {
+			case unvisited:
+				visit(m)
+			case active:
+				reversed[[2]int{n, m}] = true
+			}
+		}
+		state[n] = done
+	}
+	for n := range adj {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return reversed
+}
+
+// assignLayers assigns each node to the layer given by the longest path
+// to it from any source.
+func (ll *layeredLayout) assignLayers(acyclic [][]int) {
+	indegree := make([]int, len(acyclic))
+	for _, tos := range acyclic {
+		for _, to := range tos {
+			indegree[to]++
+		}
+	}
+	queue := []int{}
+	for n, d := range indegree {
+		if d == 0 {
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range acyclic[n] {
+			if l := ll.nodes[n].layer + 1; l > ll.nodes[m].layer {
+				ll.nodes[m].layer = l
+			}
+			indegree[m]--
+			if indegree[m] == 0 {
+				queue = append(queue, m)
+			}
+		}
+	}
+}
+
+// orderLayers reduces edge crossings by sweeping down and up the layers
+// sorting each layer by the barycenter of the positions of its
+// neighbours in the adjacent layer.
+func (ll *layeredLayout) orderLayers() {
+	setOrder := func(layer []int) {
+		for i, n := range layer {
+			ll.nodes[n].order = i
+		}
+	}
+	for _, layer := range ll.layers {
+		setOrder(layer)
+	}
+	barycenter := func(neighbours []int, current int) float64 {
+		if len(neighbours) == 0 {
+			return float64(current)
+		}
+		sum := 0
+		for _, n := range neighbours {
+			sum += ll.nodes[n].order
+		}
+		return float64(sum) / float64(len(neighbours))
+	}
+	sortLayer := func(layer []int, neighbours func(nd *layoutNode) []int) {
+		bc := make(map[int]float64, len(layer))
+		for _, n := range layer {
+			bc[n] = barycenter(neighbours(ll.nodes[n]), ll.nodes[n].order)
+		}
+		sort.SliceStable(layer, func(i, j int) bool {
+			return bc[layer[i]] < bc[layer[j]]
+		})
+		setOrder(layer)
+	}
+	for i := 0; i < layoutSweeps; i++ {
+		if i%2 == 0 {
+			for l := 1; l < len(ll.layers); l++ {
+				sortLayer(ll.layers[l], func(nd *layoutNode) []int { return nd.up })
+			}
+			continue
+		}
+		for l := len(ll.layers) - 2; l >= 0; l-- {
+			sortLayer(ll.layers[l], func(nd *layoutNode) []int { return nd.down })
+		}
+	}
+}
+
+// assignCoordinates places nodes within their layers, preserving their
+// order, by moving them towards the average position of their
+// neighbours whilst maintaining a minimum separation.
+func (ll *layeredLayout) assignCoordinates() {
+	for l, layer := range ll.layers {
+		x := 0.0
+		for _, n := range layer {
+			nd := ll.nodes[n]
+			nd.x = x + nd.width/2
+			nd.y = float64(l*layoutLayerSpacing) + layoutNodeHeight/2
+			x += nd.width + layoutNodeGap
+		}
+	}
+	for i := 0; i < layoutSweeps; i++ {
+		for _, layer := range ll.layers {
+			desired := make([]float64, len(layer))
+			for j, n := range layer {
+				nd := ll.nodes[n]
+				desired[j] = nd.x
+				if neighbours := len(nd.up) + len(nd.down); neighbours > 0 {
+					sum := 0.0
+					for _, m := range nd.up {
+						sum += ll.nodes[m].x
+					}
+					for _, m := range nd.down {
+						sum += ll.nodes[m].x
+					}
+					desired[j] = sum / float64(neighbours)
+				}
+			}
+			ll.placeLayer(layer, desired)
+		}
+	}
+	minX, maxX, maxY := 0.0, 0.0, 0.0
+	for i, nd := range ll.nodes {
+		if left := nd.x - nd.width/2; i == 0 || left < minX {
+			minX = left
+		}
+		if right := nd.x + nd.width/2; i == 0 || right > maxX {
+			maxX = right
+		}
+		if nd.y > maxY {
+			maxY = nd.y
+		}
+	}
+	for _, nd := range ll.nodes {
+		nd.x += layoutMargin - minX
+		nd.y += layoutMargin
+	}
+	ll.width = maxX - minX + 2*layoutMargin
+	ll.height = maxY + layoutNodeHeight/2 + 2*layoutMargin
+}
+
+// placeLayer positions the nodes in a layer as close as possible, in the
+// least squares sense, to their desired positions whilst preserving their
+// order and minimum separation. Subtracting the cumulative separation
+// from each position turns this into an isotonic regression which is
+// solved using the pool adjacent violators algorithm.
+func (ll *layeredLayout) placeLayer(layer []int, desired []float64) {
+	type block struct {
+		sum   float64
+		count int
+	}
+	offsets := make([]float64, len(layer))
+	for j := 1; j < len(layer); j++ {
+		a, b := ll.nodes[layer[j-1]], ll.nodes[layer[j]]
+		offsets[j] = offsets[j-1] + (a.width+b.width)/2 + layoutNodeGap
+	}
+	blocks := make([]block, 0, len(layer))
+	for j := range layer {
+		blocks = append(blocks, block{sum: desired[j] - offsets[j], count: 1})
+		for len(blocks) > 1 {
+			last, prev := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if prev.sum/float64(prev.count) <= last.sum/float64(last.count) {
+				break
+			}
+			blocks = blocks[:len(blocks)-1]
+			blocks[len(blocks)-1] = block{sum: prev.sum + last.sum, count: prev.count + last.count}
+		}
+	}
+	j := 0
+	for _, b := range blocks {
+		mean := b.sum / float64(b.count)
+		for k := 0; k < b.count; k++ {
+			ll.nodes[layer[j]].x = mean + offsets[j]
+			j++
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBreakCycles(t *testing.T) {
+	for i, tc := range []struct {
+		adj      [][]int
+		reversed map[[2]int]bool
+	}{
+		{[][]int{{1}, {2}, {}}, map[[2]int]bool{}},
+		{[][]int{{1, 2}, {3}, {3}, {}}, map[[2]int]bool{}},
+		{[][]int{{1}, {0}}, map[[2]int]bool{{1, 0}: true}},
+		// The cyclic fixture: app, x, y, z, w.
+		{[][]int{{1, 2}, {2, 4}, {3}, {1, 0}, {}}, map[[2]int]bool{{3, 1}: true, {3, 0}: true}},
+		// Cycles that are not reachable from the first node.
+		{[][]int{{}, {2}, {3}, {1}}, map[[2]int]bool{{3, 1}: true}},
+	} {
+		reversed := breakCycles(tc.adj)
+		if got, want := reversed, tc.reversed; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", i, got, want)
+		}
+		// Reversing the edges must leave no back edges.
+		acyclic := make([][]int, len(tc.adj))
+		for from, tos := range tc.adj {
+			for _, to := range tos {
+				if reversed[[2]int{from, to}] {
+					acyclic[to] = append(acyclic[to], from)
+					continue
+				}
+				acyclic[from] = append(acyclic[from], to)
+			}
+		}
+		if got := breakCycles(acyclic); len(got) != 0 {
+			t.Errorf("%v: not acyclic: %v", i, got)
+		}
+	}
+}
+
+func TestAssignLayers(t *testing.T) {
+	for i, tc := range []struct {
+		acyclic [][]int
+		layers  []int
+	}{
+		{[][]int{{1}, {2}, {}}, []int{0, 1, 2}},
+		// The longest path determines the layer.
+		{[][]int{{1, 2, 3}, {3}, {3}, {}}, []int{0, 1, 1, 2}},
+		{[][]int{{1, 3}, {2}, {3}, {}}, []int{0, 1, 2, 3}},
+		// Multiple sources all start in the first layer.
+		{[][]int{{2}, {3}, {}, {2}}, []int{0, 0, 2, 1}},
+	} {
+		ll := &layeredLayout{}
+		for range tc.acyclic {
+			ll.nodes = append(ll.nodes, &layoutNode{})
+		}
+		ll.assignLayers(tc.acyclic)
+		layers := make([]int, len(ll.nodes))
+		for j, nd := range ll.nodes {
+			layers[j] = nd.layer
+		}
+		if got, want := layers, tc.layers; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestOrderLayers(t *testing.T) {
+	for i, tc := range []struct {
+		layers [][]int
+		links  [][2]int
+		want   [][]int
+	}{
+		// A single crossing is removed.
+		{[][]int{{0, 1}, {2, 3}}, [][2]int{{0, 3}, {1, 2}}, [][]int{{0, 1}, {3, 2}}},
+		// No crossings, no changes.
+		{[][]int{{0, 1}, {2, 3}}, [][2]int{{0, 2}, {1, 3}}, [][]int{{0, 1}, {2, 3}}},
+		// The first, downward, sweep reorders the last layer.
+		{[][]int{{0}, {1, 2}, {3, 4}}, [][2]int{{0, 1}, {0, 2}, {1, 4}, {2, 3}}, [][]int{{0}, {1, 2}, {4, 3}}},
+	} {
+		ll := &layeredLayout{layers: tc.layers}
+		for l, layer := range tc.layers {
+			for range layer {
+				ll.nodes = append(ll.nodes, &layoutNode{layer: l})
+			}
+		}
+		for _, e := range tc.links {
+			ll.link(e[0], e[1])
+		}
+		ll.orderLayers()
+		if got, want := ll.layers, tc.want; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", i, got, want)
+		}
+		for _, layer := range ll.layers {
+			for j, n := range layer {
+				if got, want := ll.nodes[n].order, j; got != want {
+					t.Errorf("%v: %v: got %v, want %v", i, n, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestPlaceLayer(t *testing.T) {
+	// Nodes that are 20 wide must be at least 40 apart.
+	for i, tc := range []struct {
+		desired, placed []float64
+	}{
+		{[]float64{0}, []float64{0}},
+		{[]float64{0, 100}, []float64{0, 100}},
+		{[]float64{0, 0}, []float64{-20, 20}},
+		{[]float64{100, 0, 50}, []float64{10, 50, 90}},
+		{[]float64{0, 10, 200, 200}, []float64{-15, 25, 180, 220}},
+	} {
+		ll := &layeredLayout{}
+		layer := []int{}
+		for j := range tc.desired {
+			ll.nodes = append(ll.nodes, &layoutNode{width: 20})
+			layer = append(layer, j)
+		}
+		ll.placeLayer(layer, tc.desired)
+		placed := make([]float64, len(layer))
+		for j, n := range layer {
+			placed[j] = ll.nodes[n].x
+		}
+		if got, want := placed, tc.placed; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestNewLayeredLayout(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		layers  map[string]int
+		dummies int
+	}{
+		{"small", map[string]int{
+			"example.com/app":   0,
+			"example.com/a":     1,
+			"example.com/b":     1,
+			"example.com/c":     2,
+			"golang.org/x/text": 3,
+		}, 4},
+		// z -> x and z -> app are reversed to break the cycles.
+		{"cyclic", map[string]int{
+			"example.com/app": 0,
+			"example.com/x":   1,
+			"example.com/y":   2,
+			"example.com/w":   2,
+			"example.com/z":   3,
+		}, 4},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		dependencies, _, ordered := processGraph(fx.raw, false)
+		ll := newLayeredLayout(dependencies, ordered)
+		layers := map[string]int{}
+		dummies := 0
+		for _, nd := range ll.nodes {
+			if len(nd.module) == 0 {
+				dummies++
+				continue
+			}
+			layers[nd.module] = nd.layer
+		}
+		if got, want := layers, tc.layers; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", tc.fixture, got, want)
+		}
+		if got, want := dummies, tc.dummies; got != want {
+			t.Errorf("%v: got %v, want %v", tc.fixture, got, want)
+		}
+		for l, layer := range ll.layers {
+			for j := 1; j < len(layer); j++ {
+				a, b := ll.nodes[layer[j-1]], ll.nodes[layer[j]]
+				if sep := (a.width+b.width)/2 + layoutNodeGap; b.x-a.x < sep-1e-9 {
+					t.Errorf("%v: layer %v: nodes %v and %v overlap", tc.fixture, l, j-1, j)
+				}
+			}
+		}
+		for _, nd := range ll.nodes {
+			if left := nd.x - nd.width/2; left < layoutMargin-1e-9 {
+				t.Errorf("%v: %q: outside of the margin: %v", tc.fixture, nd.module, left)
+			}
+			if right := nd.x + nd.width/2; right > ll.width-layoutMargin+1e-9 {
+				t.Errorf("%v: %q: outside of the margin: %v > %v", tc.fixture, nd.module, right, ll.width)
+			}
+		}
+		// Every edge is drawn from the boundary of its module to the
+		// boundary of the module it depends on.
+		position := map[string]*layoutNode{}
+		for _, nd := range ll.nodes {
+			position[nd.module] = nd
+		}
+		if got, want := len(ll.edges), len(dependencies); got != want {
+			t.Errorf("%v: got %v, want %v", tc.fixture, got, want)
+		}
+		for _, le := range ll.edges {
+			from, to := position[le.Module], position[le.DependsOn]
+			first, last := le.points[0], le.points[len(le.points)-1]
+			if got, want := len(le.points), int(math.Abs(float64(from.layer-to.layer)))+1; got != want {
+				t.Errorf("%v: %v: got %v, want %v", tc.fixture, le.dependency, got, want)
+			}
+			if first.X != from.x || math.Abs(first.Y-from.y) != layoutNodeHeight/2 {
+				t.Errorf("%v: %v: starts at %v, not %v", tc.fixture, le.dependency, first, from.module)
+			}
+			if last.X != to.x || math.Abs(last.Y-to.y) != layoutNodeHeight/2 {
+				t.Errorf("%v: %v: ends at %v, not %v", tc.fixture, le.dependency, last, to.module)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/module"
+)
+
+var graphDuplicateMajorsCmd = &cobra.Command{
+	Use:   "duplicate-majors",
+	Short: "display modules that are required at more than one major version",
+	Long: `display modules that are required at more than one major version, eg.
+github.com/foo/bar and github.com/foo/bar/v2 or gopkg.in/yaml.v2 and
+gopkg.in/yaml.v3, along with the modules that require each major version.
+Use graph query --duplicate-majors to display the paths to these modules.`,
+	RunE: graphDuplicateMajors,
+}
+
+func init() {
+	graphCmd.AddCommand(graphDuplicateMajorsCmd)
+}
+
+// modulePathBase returns the module path without any major version
+// suffix, ie. /vN or, for gopkg.in, .vN.
+func modulePathBase(m string) string {
+	m = stripVersion(m)
+	if prefix, _, ok := module.SplitPathVersion(m); ok {
+		return prefix
+	}
+	return m
+}
+
+// duplicateMajors returns the modules that are required at more than one
+// major version, indexed by their path without a major version suffix.
+// Modules may be versioned, the returned module paths are not.
+func duplicateMajors(modules []string) map[string][]string {
+	paths := map[string]map[string]bool{}
+	for _, m := range modules {
+		base := modulePathBase(m)
+		if paths[base] == nil {
+			paths[base] = map[string]bool{}
+		}
+		paths[base][stripVersion(m)] = true
+	}
+	duplicates := map[string][]string{}
+	for base, majors := range paths {
+		if len(majors) < 2 {
+			continue
+		}
+		for m := range majors {
+			duplicates[base] = append(duplicates[base], m)
+		}
+		sort.Strings(duplicates[base])
+	}
+	return duplicates
+}
+
+// modules adds all of the modules in the tree to the supplied set.
+func (dt *treeNode) modules(set map[string]bool) {
+	if dt == nil {
+		return
+	}
+	set[dt.Module] = true
+	for _, c := range dt.Children {
+		c.modules(set)
+	}
+}
+
+func graphDuplicateMajors(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	dependencies, unique, ordered, err := getGraph(ctx, false)
+	if err != nil {
+		return err
+	}
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return err
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	duplicates := duplicateMajors(ordered)
+	bases := make([]string, 0, len(duplicates))
+	for base := range duplicates {
+		bases = append(bases, base)
+	}
+	out := cmd.OutOrStdout()
+	sort.Strings(bases)
+	for _, base := range bases {
+		fmt.Fprintf(out, "%v\n", base)
+		for _, m := range duplicates[base] {
+			dependents := make([]string, 0, len(graph.nodes[m].dependents))
+			for _, d := range graph.nodes[m].dependents {
+				dependents = append(dependents, d.module)
+			}
+			sort.Strings(dependents)
+			fmt.Fprintf(out, "  %v %v\n", m, selected[m])
+			fmt.Fprintf(out, "    required by: %v\n", strings.Join(dependents, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModulePathBase(t *testing.T) {
+	for _, tc := range []struct {
+		module, base string
+	}{
+		{"example.com/lib", "example.com/lib"},
+		{"example.com/lib/v2", "example.com/lib"},
+		{"example.com/lib/v2@v2.1.0", "example.com/lib"},
+		{"example.com/lib/v22@v22.0.0", "example.com/lib"},
+		{"example.com/v2", "example.com"},
+		{"gopkg.in/yaml.v3", "gopkg.in/yaml"},
+		{"gopkg.in/yaml.v2@v2.4.0", "gopkg.in/yaml"},
+		// Not a major version suffix.
+		{"example.com/lib/v1", "example.com/lib/v1"},
+		{"go@1.21", "go"},
+	} {
+		if got, want := modulePathBase(tc.module), tc.base; got != want {
+			t.Errorf("%v: got %v, want %v", tc.module, got, want)
+		}
+	}
+}
+
+func TestDuplicateMajors(t *testing.T) {
+	for _, tc := range []struct {
+		fixture    string
+		duplicates map[string][]string
+	}{
+		{"small", map[string][]string{}},
+		{"cyclic", map[string][]string{}},
+		{"versioned", map[string][]string{
+			"example.com/lib": {"example.com/lib", "example.com/lib/v2"},
+		}},
+		{"huge", map[string][]string{
+			"github.com/google/martian": {"github.com/google/martian", "github.com/google/martian/v3"},
+			"gopkg.in/yaml":             {"gopkg.in/yaml.v2", "gopkg.in/yaml.v3"},
+		}},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		// The result is the same for versioned and unversioned modules.
+		for _, versioned := range []bool{false, true} {
+			_, ordered := fx.graph(t, versioned)
+			if got, want := duplicateMajors(ordered), tc.duplicates; !reflect.DeepEqual(got, want) {
+				t.Errorf("%v: versioned %v: got %v, want %v", tc.fixture, versioned, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// moduleMetadata is obtained from the go.mod, .info and extracted source
+// files in the module cache. Fields are left empty if the information is
+// not available locally.
+type moduleMetadata struct {
+	GoVersion  string    `json:"go_version,omitempty"` // the go directive.
+	Time       time.Time `json:"time"`                 // the release, or commit, time.
+	Deprecated string    `json:"deprecated,omitempty"` // the deprecation message, if any.
+	Retracted  bool      `json:"retracted,omitempty"`  // retracted by the newest version available.
+	Rationale  string    `json:"rationale,omitempty"`  // the rationale for the retraction, if any.
+	Packages   int       `json:"packages,omitempty"`   // the number of packages, if extracted.
+	Size       int64     `json:"size,omitempty"`       // the size in bytes, if extracted.
+}
+
+// metadataLoader reads module metadata from the module cache.
+type metadataLoader struct {
+	mc *modCache
+	mp *moduleProxy
+}
+
+func newMetadataLoader(ctx context.Context) (*metadataLoader, error) {
+	mc, err := newModCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &metadataLoader{
+		mc: mc,
+		mp: &moduleProxy{dir: filepath.Join(mc.dir, "cache", "download")},
+	}, nil
+}
+
+// load returns the metadata for the specified module version, or for the
+// main module if version is empty.
+func (ml *metadataLoader) load(path, version string) (*moduleMetadata, error) {
+	md := &moduleMetadata{}
+	if len(version) == 0 {
+		f, err := ml.mc.goMod(path)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil && f.Go != nil {
+			md.GoVersion = f.Go.Version
+		}
+		if f != nil && f.Module != nil {
+			md.Deprecated = f.Module.Deprecated
+		}
+		if len(ml.mc.moddir) > 0 {
+			md.Packages, md.Size = countPackages(ml.mc.moddir)
+		}
+		return md, nil
+	}
+	f, err := ml.mc.goMod(path + "@" + version)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil && f.Go != nil {
+		md.GoVersion = f.Go.Version
+	}
+	md.Time = ml.mp.time(path, version)
+
+	// Deprecations and retractions are determined by the newest version.
+	versions, err := ml.mp.versions(path)
+	if err != nil {
+		return nil, err
+	}
+	if newest := newestVersion(versions); len(newest) > 0 && newest != version {
+		if f, err = ml.mc.goMod(path + "@" + newest); err != nil {
+			return nil, err
+		}
+	}
+	if f != nil {
+		if f.Module != nil {
+			md.Deprecated = f.Module.Deprecated
+		}
+		for _, r := range f.Retract {
+			if semver.Compare(version, r.Low) >= 0 && semver.Compare(version, r.High) <= 0 {
+				md.Retracted, md.Rationale = true, r.Rationale
+				break
+			}
+		}
+	}
+
+	ep, err := module.EscapePath(path)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	md.Packages, md.Size = countPackages(filepath.Join(ml.mc.dir, ep+"@"+ev))
+	return md, nil
+}
+
+// countPackages returns the number of directories containing go files,
+// and the total size of all files, in the module rooted at dir. Nested
+// modules, testdata and vendor directories are skipped.
+func countPackages(dir string) (int, int64) {
+	packages, size := 0, int64(0)
+	counted := map[string]bool{}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path == dir {
+				return nil
+			}
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		size += info.Size()
+		if d := filepath.Dir(path); !counted[d] && strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+			counted[d] = true
+			packages++
+		}
+		return nil
+	})
+	return packages, size
+}
+
+// loadMetadata returns the metadata for each of the supplied modules,
+// which may be versioned. Modules that are neither versioned, selected
+// nor the root, eg. groups, have no metadata.
+func loadMetadata(ctx context.Context, modules []string, selected map[string]string) (map[string]*moduleMetadata, error) {
+	root, err := getRoot(ctx, goCmd{})
+	if err != nil {
+		return nil, err
+	}
+	ml, err := newMetadataLoader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]*moduleMetadata, len(modules))
+	for _, m := range modules {
+		if isPseudoModule(m) {
+			continue
+		}
+		version := moduleVersion(m, selected)
+		if len(version) == 0 && m != root {
+			continue
+		}
+		md, err := ml.load(stripVersion(m), version)
+		if err != nil {
+			return nil, err
+		}
+		metadata[m] = md
+	}
+	return metadata, nil
+}
+
+// goVersion is a go version as used by go directives and toolchains, eg.
+// 1.21, 1.21rc1 or 1.21.0. Versions are ordered as per go/version, that
+// is, the language version 1.21 precedes 1.21rc1 which precedes 1.21.0.
+type goVersion struct {
+	major, minor, patch string
+	kind, pre           string // kind is alpha, beta or rc for prereleases.
+}
+
+// cutInt returns the leading decimal number in s and the remainder of s.
+func cutInt(s string) (string, string, bool) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 || (s[0] == '0' && i > 1) {
+		return "", "", false
+	}
+	return s[:i], s[i:], true
+}
+
+// parseGoVersion parses a go version, with or without a go prefix.
+func parseGoVersion(v string) (goVersion, bool) {
+	var gv goVersion
+	var ok bool
+	v = strings.TrimPrefix(v, "go")
+	if gv.major, v, ok = cutInt(v); !ok {
+		return gv, false
+	}
+	if len(v) == 0 {
+		// 1 is the same as 1.0.0.
+		gv.minor, gv.patch = "0", "0"
+		return gv, true
+	}
+	if v[0] != '.' {
+		return gv, false
+	}
+	if gv.minor, v, ok = cutInt(v[1:]); !ok {
+		return gv, false
+	}
+	switch {
+	case len(v) == 0:
+		return gv, true
+	case v[0] == '.':
+		gv.patch, v, ok = cutInt(v[1:])
+		return gv, ok && len(v) == 0
+	}
+	for _, kind := range []string{"alpha", "beta", "rc"} {
+		if strings.HasPrefix(v, kind) {
+			gv.kind = kind
+			gv.pre, v, ok = cutInt(v[len(kind):])
+			return gv, ok && len(v) == 0
+		}
+	}
+	return gv, false
+}
+
+// compareGoVersions returns -1, 0 or 1 as per go/version.Compare.
+func compareGoVersions(a, b goVersion) int {
+	// Decimal numbers without leading zeros, or empty strings, can be
+	// compared by length and then lexically.
+	cmpInt := func(x, y string) int {
+		switch {
+		case len(x) < len(y):
+			return -1
+		case len(x) > len(y):
+			return 1
+		}
+		return strings.Compare(x, y)
+	}
+	if c := cmpInt(a.major, b.major); c != 0 {
+		return c
+	}
+	if c := cmpInt(a.minor, b.minor); c != 0 {
+		return c
+	}
+	if c := cmpInt(a.patch, b.patch); c != 0 {
+		return c
+	}
+	// The empty kind, ie. a language version, precedes all prereleases.
+	if c := strings.Compare(a.kind, b.kind); c != 0 {
+		return c
+	}
+	return cmpInt(a.pre, b.pre)
+}
+
+// metadataFilter returns a function that returns true for metadata that
+// satisfies all of the comma separated conditions in spec. Conditions are
+// deprecated, retracted or one of go, packages, size or released compared
+// to a value using <, <=, >, >=, = or !=, eg. go<1.17 or
+// released<2020-01-01.
+func metadataFilter(spec string) (func(md *moduleMetadata) bool, error) {
+	conditions := []func(md *moduleMetadata) bool{}
+	for _, cond := range strings.Split(spec, ",") {
+		cond = strings.TrimSpace(cond)
+		switch cond {
+		case "":
+			continue
+		case "deprecated":
+			conditions = append(conditions, func(md *moduleMetadata) bool { return len(md.Deprecated) > 0 })
+			continue
+		case "retracted":
+			conditions = append(conditions, func(md *moduleMetadata) bool { return md.Retracted })
+			continue
+		}
+		idx := strings.IndexAny(cond, "<>=!")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid condition: %q", cond)
+		}
+		key, rest := cond[:idx], cond[idx:]
+		op := rest[:1]
+		if len(rest) > 1 && rest[1] == '=' {
+			op = rest[:2]
+		}
+		value := rest[len(op):]
+		if op == "!" {
+			return nil, fmt.Errorf("invalid condition: %q", cond)
+		}
+		// known returns false if the metadata needed by the condition is
+		// not available, in which case the condition is never satisfied.
+		var known func(md *moduleMetadata) bool
+		var compare func(md *moduleMetadata) int
+		switch key {
+		case "go":
+			v, ok := parseGoVersion(value)
+			if !ok {
+				return nil, fmt.Errorf("invalid go version in condition: %q", cond)
+			}
+			known = func(md *moduleMetadata) bool {
+				_, ok := parseGoVersion(md.GoVersion)
+				return ok
+			}
+			compare = func(md *moduleMetadata) int {
+				gv, _ := parseGoVersion(md.GoVersion)
+				return compareGoVersions(gv, v)
+			}
+		case "packages", "size":
+			known = func(md *moduleMetadata) bool { return md.Size > 0 }
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number in condition: %q: %v", cond, err)
+			}
+			compare = func(md *moduleMetadata) int {
+				v := int64(md.Packages)
+				if key == "size" {
+					v = md.Size
+				}
+				switch {
+				case v < n:
+					return -1
+				case v > n:
+					return 1
+				}
+				return 0
+			}
+		case "released":
+			known = func(md *moduleMetadata) bool { return !md.Time.IsZero() }
+			t, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date in condition: %q: %v", cond, err)
+			}
+			compare = func(md *moduleMetadata) int {
+				switch {
+				case md.Time.Before(t):
+					return -1
+				case md.Time.After(t):
+					return 1
+				}
+				return 0
+			}
+		default:
+			return nil, fmt.Errorf("unsupported condition: %q", cond)
+		}
+		match := map[string]func(c int) bool{
+			"<":  func(c int) bool { return c < 0 },
+			"<=": func(c int) bool { return c <= 0 },
+			">":  func(c int) bool { return c > 0 },
+			">=": func(c int) bool { return c >= 0 },
+			"=":  func(c int) bool { return c == 0 },
+			"==": func(c int) bool { return c == 0 },
+			"!=": func(c int) bool { return c != 0 },
+		}[op]
+		if match == nil {
+			return nil, fmt.Errorf("unsupported comparison in condition: %q", cond)
+		}
+		conditions = append(conditions, func(md *moduleMetadata) bool { return known(md) && match(compare(md)) })
+	}
+	return func(md *moduleMetadata) bool {
+		if md == nil {
+			return false
+		}
+		for _, c := range conditions {
+			if !c(md) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// filterByMetadata restricts the tree to the paths that include a module
+// whose metadata satisfies the conditions in spec.
+func filterByMetadata(ctx context.Context, tree *treeNode, spec string) (*treeNode, error) {
+	match, err := metadataFilter(spec)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return nil, err
+	}
+	modules := map[string]bool{}
+	tree.modules(modules)
+	all := make([]string, 0, len(modules))
+	for m := range modules {
+		all = append(all, m)
+	}
+	metadata, err := loadMetadata(ctx, all, selected)
+	if err != nil {
+		return nil, err
+	}
+	return filter(tree, func(tn *treeNode) bool {
+		return match(metadata[tn.Module])
+	}, false), nil
+}
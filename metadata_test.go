@@ -0,0 +1,132 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareGoVersions(t *testing.T) {
+	ordered := []string{"1", "1.9", "1.10", "1.17", "1.21", "1.21rc1", "1.21rc2", "1.21.0", "go1.21.1", "1.21.10", "1.22beta1", "2"}
+	for i, a := range ordered {
+		av, ok := parseGoVersion(a)
+		if !ok {
+			t.Errorf("%v: failed to parse", a)
+			continue
+		}
+		for j, b := range ordered {
+			bv, _ := parseGoVersion(b)
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got := compareGoVersions(av, bv); got != want {
+				t.Errorf("%v %v: got %v, want %v", a, b, got, want)
+			}
+		}
+	}
+	for _, v := range []string{"1.0.0", "go1"} {
+		if gv, ok := parseGoVersion(v); !ok || compareGoVersions(gv, goVersion{major: "1", minor: "0", patch: "0"}) != 0 {
+			t.Errorf("%v: got %+v, %v", v, gv, ok)
+		}
+	}
+	for _, v := range []string{"", "v1.21", "1.", "1.21.", "1.21x1", "1.21rc", "1.021", "1.21.0rc1", "1.21.0.1"} {
+		if _, ok := parseGoVersion(v); ok {
+			t.Errorf("%v: unexpectedly parsed", v)
+		}
+	}
+}
+
+func TestMetadataFilter(t *testing.T) {
+	released := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := &moduleMetadata{GoVersion: "1.16", Time: released, Packages: 3, Size: 1000}
+	rc := &moduleMetadata{GoVersion: "1.21rc1"}
+	release := &moduleMetadata{GoVersion: "1.21.0", Deprecated: "use another", Retracted: true}
+	unknown := &moduleMetadata{}
+	all := []*moduleMetadata{old, rc, release, unknown, nil}
+	for _, tc := range []struct {
+		spec    string
+		matches []*moduleMetadata
+	}{
+		{"", []*moduleMetadata{old, rc, release, unknown}},
+		{"deprecated", []*moduleMetadata{release}},
+		{" retracted , deprecated ", []*moduleMetadata{release}},
+		{"go<1.17", []*moduleMetadata{old}},
+		{"go<1.21", []*moduleMetadata{old}},
+		{"go>=1.21", []*moduleMetadata{rc, release}},
+		{"go<1.21.0", []*moduleMetadata{old, rc}},
+		{"go>1.21rc1", []*moduleMetadata{release}},
+		{"go=1.21.0", []*moduleMetadata{release}},
+		{"go!=1.21.0", []*moduleMetadata{old, rc}},
+		{"packages>2", []*moduleMetadata{old}},
+		{"size<=1000,packages==3", []*moduleMetadata{old}},
+		{"released<2021-01-01", []*moduleMetadata{old}},
+		{"released>2021-01-01", nil},
+		{"go<1.17,deprecated", nil},
+	} {
+		match, err := metadataFilter(tc.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tc.spec, err)
+			continue
+		}
+		var got []*moduleMetadata
+		for _, md := range all {
+			if match(md) {
+				got = append(got, md)
+			}
+		}
+		if len(got) != len(tc.matches) {
+			t.Errorf("%q: got %v matches, want %v", tc.spec, len(got), len(tc.matches))
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.matches[i] {
+				t.Errorf("%q: %v: got %+v, want %+v", tc.spec, i, got[i], tc.matches[i])
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		spec, err string
+	}{
+		{"old", `invalid condition: "old"`},
+		{"<1.17", `invalid condition: "<1.17"`},
+		{"go!1.17", `invalid condition: "go!1.17"`},
+		{"go<v1.17", `invalid go version in condition: "go<v1.17"`},
+		{"go<1.17.x", `invalid go version in condition: "go<1.17.x"`},
+		{"size>big", `invalid number in condition: "size>big"`},
+		{"released<2020", `invalid date in condition: "released<2020"`},
+		{"stars>10", `unsupported condition: "stars>10"`},
+		{"go=<1.17", `invalid go version in condition: "go=<1.17"`},
+	} {
+		_, err := metadataFilter(tc.spec)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("%q: got %v, want %v", tc.spec, err, tc.err)
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	n := annotatedNode{Metadata: &moduleMetadata{
+		GoVersion:  "1.21",
+		Time:       time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		Packages:   2,
+		Size:       100,
+		Deprecated: "use \"example.com/new\"\n\tor C:\\new\\",
+		Retracted:  true,
+		Rationale:  `bad \n`,
+	}}
+	if got, want := n.Description(), `go 1.21\nreleased 2020-06-01\n2 packages, 100 bytes\ndeprecated: use \"example.com/new\"\n	or C:\\new\\\nretracted: bad \\n`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := (annotatedNode{}).Description(), ""; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
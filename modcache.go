@@ -0,0 +1,214 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// getGoEnv returns the values of the requested go environment variables.
+func getGoEnv(ctx context.Context, vars ...string) (map[string]string, error) {
+	output, err := goCmd{}.output(ctx, append([]string{"env", "-json"}, vars...)...)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	if err := json.Unmarshal(output, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse output of `go env`: %v", err)
+	}
+	return env, nil
+}
+
+// isPseudoModule returns true for the go and toolchain entries that
+// go mod graph reports but which are not modules.
+func isPseudoModule(m string) bool {
+	m = stripVersion(m)
+	return m == "go" || m == "toolchain"
+}
+
+// getMainModules returns the go.mod file of each of the main modules,
+// indexed by module path, as reported by `go list -m -json`. There is
+// more than one main module in workspace mode.
+func getMainModules(ctx context.Context) (map[string]string, error) {
+	output, err := goCmd{}.output(ctx, "list", "-m", "-json")
+	if err != nil {
+		return nil, err
+	}
+	gomods := map[string]string{}
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var m struct{ Path, GoMod string }
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse output of `go list -m -json`: %v", err)
+		}
+		if len(m.GoMod) > 0 {
+			gomods[m.Path] = m.GoMod
+		}
+	}
+	return gomods, nil
+}
+
+// modCache provides access to go.mod files for the main modules and the
+// module download cache. Parsed files are cached.
+type modCache struct {
+	dir    string            // $GOMODCACHE
+	gomod  string            // the main module's go.mod, or the file specified by --modfile
+	gomods map[string]string // the go.mod files of the main modules in a workspace
+	moddir string            // the main module's directory
+	parsed map[string]*modfile.File
+}
+
+func newModCache(ctx context.Context) (*modCache, error) {
+	env, err := getGoEnv(ctx, "GOMODCACHE", "GOMOD")
+	if err != nil {
+		return nil, err
+	}
+	gomod := env["GOMOD"]
+	var gomods map[string]string
+	if modfile := modFile(); len(modfile) > 0 {
+		// --modfile is not supported in workspace mode.
+		gomod = modfile
+	} else if gomods, err = getMainModules(ctx); err != nil {
+		return nil, err
+	}
+	moddir := ""
+	if len(env["GOMOD"]) > 0 && env["GOMOD"] != os.DevNull {
+		moddir = filepath.Dir(env["GOMOD"])
+	}
+	return &modCache{
+		dir:    env["GOMODCACHE"],
+		gomod:  gomod,
+		gomods: gomods,
+		moddir: moddir,
+		parsed: map[string]*modfile.File{},
+	}, nil
+}
+
+// downloadPath returns the path of the file with the specified suffix,
+// eg. .mod or .info, for module@version in the module download cache.
+func (mc *modCache) downloadPath(path, version, suffix string) (string, error) {
+	return proxyPath(filepath.Join(mc.dir, "cache", "download"), path, version, suffix)
+}
+
+// proxyPath returns the path of the file with the specified suffix for
+// module@version in a GOPROXY style directory.
+func proxyPath(dir, path, version, suffix string) (string, error) {
+	ep, err := module.EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	ev, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ep, "@v", ev+suffix), nil
+}
+
+// goMod returns the parsed go.mod file for the supplied module, which
+// is of the form path@version, or the main module's go.mod, or that of
+// the named workspace module, if it has no version. A nil file is
+// returned if the go.mod file is not available or cannot be parsed, the
+// latter is recorded as a diagnostic.
+func (mc *modCache) goMod(m string) (*modfile.File, error) {
+	if f, ok := mc.parsed[m]; ok {
+		return f, nil
+	}
+	filename := mc.gomod
+	if idx := strings.Index(m, "@"); idx > 0 {
+		var err error
+		if filename, err = mc.downloadPath(m[:idx], m[idx+1:], ".mod"); err != nil {
+			return nil, err
+		}
+	} else if gomod, ok := mc.gomods[m]; ok {
+		filename = gomod
+	}
+	mc.parsed[m] = nil
+	if len(filename) == 0 {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil
+	}
+	f, err := modfile.ParseLax(filename, buf, nil)
+	if err != nil {
+		// As for a missing file, eg. a corrupt entry in the module cache.
+		moduleDiagnostics.addInvalidGoMod(err.Error())
+		return nil, nil
+	}
+	mc.parsed[m] = f
+	return f, nil
+}
+
+// requirement records the versions of a dependency that are required
+// and whether all of those requirements are marked as indirect.
+type requirement struct {
+	Versions []string
+	Indirect bool
+}
+
+// getRequirements returns the requirements that make up each of the
+// dependencies obtained by processing raw with the specified value of
+// versioned.
+func getRequirements(mc *modCache, raw []dependency, versioned bool) (map[dependency]*requirement, error) {
+	reqs := map[dependency]*requirement{}
+	for _, r := range raw {
+		if isPseudoModule(r.DependsOn) {
+			continue
+		}
+		f, err := mc.goMod(r.Module)
+		if err != nil {
+			return nil, err
+		}
+		path, version := stripVersion(r.DependsOn), moduleVersion(r.DependsOn, nil)
+		indirect := false
+		if f != nil {
+			for _, req := range f.Require {
+				if req.Mod.Path == path && req.Mod.Version == version {
+					indirect = req.Indirect
+					break
+				}
+			}
+		}
+		dep := r
+		if !versioned {
+			dep = dependency{Module: stripVersion(r.Module), DependsOn: path}
+		}
+		req := reqs[dep]
+		if req == nil {
+			req = &requirement{Indirect: true}
+			reqs[dep] = req
+		}
+		req.Indirect = req.Indirect && indirect
+		found := false
+		for _, v := range req.Versions {
+			found = found || v == version
+		}
+		if !found {
+			req.Versions = append(req.Versions, version)
+		}
+	}
+	for _, req := range reqs {
+		sort.Slice(req.Versions, func(i, j int) bool {
+			return semver.Compare(req.Versions[i], req.Versions[j]) < 0
+		})
+	}
+	return reqs, nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphOutdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Short: "display the modules for which newer versions are available",
+	Long: `display the modules for which newer versions are available, how far behind
+the selected version is and, where timestamps are available, how much older
+the selected version is than the newest. Available versions are read from a
+GOPROXY style directory, or file:// URL, specified by --proxy or by default
+from the module download cache, and hence no network access is required.
+Prerelease and pseudo versions are only considered to be newer if no
+release versions are available.`,
+	RunE: graphOutdated,
+}
+
+func init() {
+	graphCmd.AddCommand(graphOutdatedCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphOutdatedCmd.Flags(), "outdated", &graphState, nil, nil))
+}
+
+// moduleProxy provides read-only access to a GOPROXY style directory such
+// as a file:// proxy mirror or the cache/download directory of the module
+// cache.
+type moduleProxy struct {
+	dir string
+}
+
+func newModuleProxy(ctx context.Context, proxy string) (*moduleProxy, error) {
+	if len(proxy) == 0 {
+		env, err := getGoEnv(ctx, "GOMODCACHE")
+		if err != nil {
+			return nil, err
+		}
+		return &moduleProxy{dir: filepath.Join(env["GOMODCACHE"], "cache", "download")}, nil
+	}
+	if strings.HasPrefix(proxy, "file://") {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = filepath.FromSlash(u.Path)
+	}
+	return &moduleProxy{dir: proxy}, nil
+}
+
+// versions returns the versions of the module that are available, using
+// both the @v/list file, if any, and the .info and .mod files present.
+func (mp *moduleProxy) versions(path string) ([]string, error) {
+	ep, err := module.EscapePath(path)
+	if err != nil {
+		return nil, err
+	}
+	list := filepath.Join(mp.dir, ep, "@v", "list")
+	found := map[string]bool{}
+	if buf, err := ioutil.ReadFile(list); err == nil {
+		sc := bufio.NewScanner(bytes.NewBuffer(buf))
+		for sc.Scan() {
+			if fields := strings.Fields(sc.Text()); len(fields) > 0 {
+				found[fields[0]] = true
+			}
+		}
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(mp.dir, ep, "@v"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if ext != ".info" && ext != ".mod" {
+			continue
+		}
+		if v, err := module.UnescapeVersion(strings.TrimSuffix(e.Name(), ext)); err == nil {
+			found[v] = true
+		}
+	}
+	versions := make([]string, 0, len(found))
+	for v := range found {
+		if semver.IsValid(v) {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+	return versions, nil
+}
+
+// time returns the commit time recorded in the .info file for the
+// specified module version or the zero time if it is not available.
+func (mp *moduleProxy) time(path, version string) time.Time {
+	info := struct {
+		Version string
+		Time    time.Time
+	}{}
+	filename, err := proxyPath(mp.dir, path, version, ".info")
+	if err != nil {
+		return info.Time
+	}
+	if buf, err := ioutil.ReadFile(filename); err == nil {
+		json.Unmarshal(buf, &info)
+	}
+	return info.Time
+}
+
+// newestVersion returns the newest release version, or if there are no
+// release versions, the newest version.
+func newestVersion(versions []string) string {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if len(semver.Prerelease(versions[i])) == 0 {
+			return versions[i]
+		}
+	}
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
+
+// staleness records how far behind the newest available version the
+// selected version of a module is.
+type staleness struct {
+	Module   string
+	Selected string
+	Newest   string
+	Gap      int // index into versionGaps.
+	Behind   int // number of newer release versions.
+	Age      time.Duration
+}
+
+func (mp *moduleProxy) staleness(path, selected string) (*staleness, error) {
+	versions, err := mp.versions(path)
+	if err != nil {
+		return nil, err
+	}
+	newest := newestVersion(versions)
+	if len(newest) == 0 || semver.Compare(newest, selected) <= 0 {
+		return nil, nil
+	}
+	st := &staleness{
+		Module:   path,
+		Selected: selected,
+		Newest:   newest,
+		Gap:      versionGap(selected, newest),
+	}
+	for _, v := range versions {
+		if len(semver.Prerelease(v)) == 0 && semver.Compare(v, selected) > 0 {
+			st.Behind++
+		}
+	}
+	if from, to := mp.time(path, selected), mp.time(path, newest); !from.IsZero() && !to.IsZero() {
+		st.Age = to.Sub(from)
+	}
+	return st, nil
+}
+
+func formatAge(age time.Duration) string {
+	if age <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%vd", int(age.Hours()/24))
+}
+
+func graphOutdated(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mp, err := newModuleProxy(ctx, graphState.OutdatedProxy)
+	if err != nil {
+		return err
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	modules := make([]string, 0, len(selected))
+	for m, v := range selected {
+		// main modules have no version.
+		if len(v) > 0 {
+			modules = append(modules, m)
+		}
+	}
+	sort.Strings(modules)
+	stale := []*staleness{}
+	for _, m := range modules {
+		st, err := mp.staleness(m, selected[m])
+		if err != nil {
+			return err
+		}
+		if st != nil {
+			stale = append(stale, st)
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].Gap > stale[j].Gap
+	})
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "module\tselected\tnewest\tgap\tbehind\tage\n")
+	for _, st := range stale {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", st.Module, st.Selected, st.Newest, versionGaps[st.Gap], st.Behind, formatAge(st.Age))
+	}
+	return tw.Flush()
+}
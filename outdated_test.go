@@ -0,0 +1,127 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewestVersion(t *testing.T) {
+	for _, tc := range []struct {
+		versions []string
+		newest   string
+	}{
+		{nil, ""},
+		{[]string{"v1.0.0"}, "v1.0.0"},
+		{[]string{"v1.0.0", "v1.1.0"}, "v1.1.0"},
+		{[]string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1"}, "v1.1.0"},
+		{[]string{"v0.0.0-20200101000000-abcdefabcdef", "v1.0.0"}, "v1.0.0"},
+		{[]string{"v1.0.0-rc.1", "v1.0.0-rc.2"}, "v1.0.0-rc.2"},
+		{[]string{"v0.0.0-20200101000000-abcdefabcdef", "v0.0.0-20210101000000-abcdefabcdef"}, "v0.0.0-20210101000000-abcdefabcdef"},
+	} {
+		if got, want := newestVersion(tc.versions), tc.newest; got != want {
+			t.Errorf("%v: got %v, want %v", tc.versions, got, want)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for _, tc := range []struct {
+		age time.Duration
+		out string
+	}{
+		{0, ""},
+		{-time.Hour, ""},
+		{time.Hour, "0d"},
+		{24 * time.Hour, "1d"},
+		{60*24*time.Hour + 23*time.Hour, "60d"},
+	} {
+		if got, want := formatAge(tc.age), tc.out; got != want {
+			t.Errorf("%v: got %v, want %v", tc.age, got, want)
+		}
+	}
+}
+
+func TestModuleProxy(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "small", "proxy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, proxy := range []string{dir, "file://" + filepath.ToSlash(dir)} {
+		mp, err := newModuleProxy(context.Background(), proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := mp.dir, dir; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	mp := &moduleProxy{dir: dir}
+	for _, tc := range []struct {
+		module, selected string
+		versions         []string
+		staleness        *staleness
+	}{
+		{"example.com/a", "v1.0.0", []string{"v1.0.0", "v1.1.0", "v1.2.0"}, &staleness{
+			Module:   "example.com/a",
+			Selected: "v1.0.0",
+			Newest:   "v1.2.0",
+			Gap:      3,
+			Behind:   2,
+			Age:      60 * 24 * time.Hour,
+		}},
+		// Versions are also obtained from the .mod files, there is no
+		// age since there are no .info files.
+		{"example.com/b", "v1.1.0", []string{"v1.1.0", "v1.1.1"}, &staleness{
+			Module:   "example.com/b",
+			Selected: "v1.1.0",
+			Newest:   "v1.1.1",
+			Gap:      2,
+			Behind:   1,
+		}},
+		{"example.com/c", "v1.3.0", []string{"v1.2.0", "v1.3.0"}, nil},
+		// Prereleases are not newer than a release.
+		{"golang.org/x/text", "v0.3.7", []string{"v0.3.0", "v0.3.7", "v0.4.0-rc.1"}, nil},
+		{"example.com/unknown", "v1.0.0", []string{}, nil},
+	} {
+		versions, err := mp.versions(tc.module)
+		if err != nil {
+			t.Errorf("%v: %v", tc.module, err)
+			continue
+		}
+		if got, want := versions, tc.versions; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", tc.module, got, want)
+		}
+		st, err := mp.staleness(tc.module, tc.selected)
+		if err != nil {
+			t.Errorf("%v: %v", tc.module, err)
+			continue
+		}
+		if got, want := st, tc.staleness; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %+v, want %+v", tc.module, got, want)
+		}
+	}
+}
+
+func TestFakeGoOutdated(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("testdata", "small", "proxy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := runGodep(t, "small", "graph", "outdated", "--proxy=file://"+filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tabwriter pads the empty age.
+	if got, want := out, "module         selected  newest  gap    behind  age\n"+
+		"example.com/a  v1.0.0    v1.2.0  minor  2       60d\n"+
+		"example.com/b  v1.1.0    v1.1.1  patch  1       \n"; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+func init() {
+	must(pflagvar.RegisterFlagsInStruct(graphCmd.PersistentFlags(), "out", &graphState, nil, nil))
+	graphCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		moduleDiagnostics = &diagnostics{}
+		moduleGraphs = map[bool]*graphBuilder{}
+		writeOutputTo(cmd)
+	}
+	graphCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		moduleDiagnostics.summary(cmd.ErrOrStderr())
+	}
+}
+
+// writeOutputTo arranges for the command's RunE to write its output to
+// the file specified by --out, if any. Commands write their output to
+// cmd.OutOrStdout(). RunE is wrapped, rather than using the pre and post
+// run hooks, since cobra does not run the post run hooks if RunE fails.
+func writeOutputTo(cmd *cobra.Command) {
+	const wrapped = "output"
+	if cmd.RunE == nil || len(cmd.Annotations[wrapped]) > 0 {
+		return
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[wrapped] = "true"
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(graphState.Out) == 0 {
+			return run(cmd, args)
+		}
+		return writeOutput(graphState.Out, cmd, func() error {
+			return run(cmd, args)
+		})
+	}
+}
+
+// writeOutput runs fn with the command's output set to a temporary file
+// in the same directory as filename which is renamed to filename if fn
+// succeeds and removed otherwise. Hence an existing file is only
+// replaced by complete output.
+func writeOutput(filename string, cmd *cobra.Command, fn func() error) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(filename); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	cmd.SetOut(f)
+	err = fn()
+	cmd.SetOut(nil)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lineError describes a malformed line in the output of go mod graph.
+type lineError struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %v: %v: %q", e.Line, e.Reason, e.Text)
+}
+
+// parseLine parses a single line of go mod graph output, which is of the
+// form <module>[@<version>] <dependency>@<version>.
+func parseLine(line string) (dependency, string) {
+	parts := strings.Split(line, " ")
+	if len(parts) != 2 {
+		return dependency{}, fmt.Sprintf("expected 2 space separated fields, found %v", len(parts))
+	}
+	if len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return dependency{}, "empty module"
+	}
+	if !strings.Contains(parts[1], "@") {
+		return dependency{}, "dependency has no version"
+	}
+	return dependency{Module: parts[0], DependsOn: parts[1]}, ""
+}
+
+// parseModGraph reads the output of go mod graph from rd and calls add for
+// each dependency as it is read. Malformed lines are skipped and returned.
+// Parsing stops with ctx.Err() if ctx is canceled.
+func parseModGraph(ctx context.Context, rd io.Reader, add func(dependency)) ([]*lineError, error) {
+	var malformed []*lineError
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		if line%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		dep, reason := parseLine(sc.Text())
+		if len(reason) > 0 {
+			malformed = append(malformed, &lineError{Line: line, Text: sc.Text(), Reason: reason})
+			continue
+		}
+		add(dep)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return malformed, ctx.Err()
+}
+
+// graphBuilder incrementally builds the dependencies, the set of unique
+// modules and the modules in the order in which they first appear from
+// raw, versioned, dependencies. If versioned is false, all versions are
+// stripped and the dependencies deduplicated.
+type graphBuilder struct {
+	versioned    bool
+	dependencies []dependency
+	unique       map[string]bool
+	ordered      []string
+	seen         map[dependency]bool
+}
+
+func newGraphBuilder(versioned bool) *graphBuilder {
+	return &graphBuilder{
+		versioned: versioned,
+		unique:    map[string]bool{},
+		seen:      map[dependency]bool{},
+	}
+}
+
+func (gb *graphBuilder) addModule(m string) {
+	if !gb.unique[m] {
+		gb.unique[m] = true
+		gb.ordered = append(gb.ordered, m)
+	}
+}
+
+func (gb *graphBuilder) add(dep dependency) {
+	if !gb.versioned {
+		dep = dependency{Module: stripVersion(dep.Module), DependsOn: stripVersion(dep.DependsOn)}
+		if gb.seen[dep] {
+			return
+		}
+		gb.seen[dep] = true
+	}
+	gb.addModule(dep.Module)
+	gb.addModule(dep.DependsOn)
+	gb.dependencies = append(gb.dependencies, dep)
+}
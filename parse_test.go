@@ -0,0 +1,129 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	for i, tc := range []struct {
+		line   string
+		dep    dependency
+		reason string
+	}{
+		{"example.com/app example.com/a@v1.0.0", dependency{Module: "example.com/app", DependsOn: "example.com/a@v1.0.0"}, ""},
+		{"example.com/a@v1.0.0 example.com/b@v1.1.0", dependency{Module: "example.com/a@v1.0.0", DependsOn: "example.com/b@v1.1.0"}, ""},
+		{"go@1.21 toolchain@go1.21.0", dependency{Module: "go@1.21", DependsOn: "toolchain@go1.21.0"}, ""},
+		{"", dependency{}, "expected 2 space separated fields, found 1"},
+		{"example.com/app", dependency{}, "expected 2 space separated fields, found 1"},
+		{"example.com/app example.com/a@v1.0.0 extra", dependency{}, "expected 2 space separated fields, found 3"},
+		{"example.com/app  example.com/a@v1.0.0", dependency{}, "expected 2 space separated fields, found 3"},
+		{" example.com/a@v1.0.0", dependency{}, "empty module"},
+		{"example.com/app example.com/a", dependency{}, "dependency has no version"},
+	} {
+		dep, reason := parseLine(tc.line)
+		if got, want := dep, tc.dep; got != want {
+			t.Errorf("%v: %q: got %v, want %v", i, tc.line, got, want)
+		}
+		if got, want := reason, tc.reason; got != want {
+			t.Errorf("%v: %q: got %q, want %q", i, tc.line, got, want)
+		}
+	}
+}
+
+func TestParseModGraph(t *testing.T) {
+	input := `example.com/app example.com/a@v1.0.0
+example.com/app
+example.com/a@v1.0.0 example.com/b@v1.1.0
+example.com/a@v1.0.0 example.com/b
+example.com/b@v1.1.0 example.com/c@v1.2.0
+`
+	var deps []dependency
+	malformed, err := parseModGraph(context.Background(), strings.NewReader(input), func(dep dependency) {
+		deps = append(deps, dep)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := deps, []dependency{
+		{Module: "example.com/app", DependsOn: "example.com/a@v1.0.0"},
+		{Module: "example.com/a@v1.0.0", DependsOn: "example.com/b@v1.1.0"},
+		{Module: "example.com/b@v1.1.0", DependsOn: "example.com/c@v1.2.0"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := malformed, []*lineError{
+		{Line: 2, Text: "example.com/app", Reason: "expected 2 space separated fields, found 1"},
+		{Line: 4, Text: "example.com/a@v1.0.0 example.com/b", Reason: "dependency has no version"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Cancellation is detected whilst parsing.
+	var lines strings.Builder
+	for i := 0; i < 4096; i++ {
+		fmt.Fprintf(&lines, "example.com/app example.com/m%v@v1.0.0\n", i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	_, err = parseModGraph(ctx, strings.NewReader(lines.String()), func(dependency) {
+		if n++; n == 10 {
+			cancel()
+		}
+	})
+	if got, want := err, context.Canceled; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if n >= 4096 {
+		t.Errorf("parsing was not canceled: %v lines", n)
+	}
+}
+
+func TestGraphBuilder(t *testing.T) {
+	raw := []dependency{
+		{Module: "example.com/app", DependsOn: "example.com/a@v1.0.0"},
+		{Module: "example.com/app", DependsOn: "example.com/b@v1.1.0"},
+		{Module: "example.com/a@v1.0.0", DependsOn: "example.com/b@v1.0.0"},
+		{Module: "example.com/a@v1.0.0", DependsOn: "example.com/b@v1.1.0"},
+		{Module: "example.com/b@v1.1.0", DependsOn: "example.com/a@v1.0.0"},
+	}
+	for _, tc := range []struct {
+		versioned    bool
+		dependencies []dependency
+		ordered      []string
+	}{
+		{true, raw, []string{"example.com/app", "example.com/a@v1.0.0", "example.com/b@v1.1.0", "example.com/b@v1.0.0"}},
+		{false, []dependency{
+			{Module: "example.com/app", DependsOn: "example.com/a"},
+			{Module: "example.com/app", DependsOn: "example.com/b"},
+			{Module: "example.com/a", DependsOn: "example.com/b"},
+			{Module: "example.com/b", DependsOn: "example.com/a"},
+		}, []string{"example.com/app", "example.com/a", "example.com/b"}},
+	} {
+		gb := newGraphBuilder(tc.versioned)
+		for _, dep := range raw {
+			gb.add(dep)
+		}
+		if got, want := gb.dependencies, tc.dependencies; !reflect.DeepEqual(got, want) {
+			t.Errorf("versioned %v: got %v, want %v", tc.versioned, got, want)
+		}
+		if got, want := gb.ordered, tc.ordered; !reflect.DeepEqual(got, want) {
+			t.Errorf("versioned %v: got %v, want %v", tc.versioned, got, want)
+		}
+		if got, want := len(gb.unique), len(tc.ordered); got != want {
+			t.Errorf("versioned %v: got %v, want %v", tc.versioned, got, want)
+		}
+		for _, m := range tc.ordered {
+			if !gb.unique[m] {
+				t.Errorf("versioned %v: %v is not in unique", tc.versioned, m)
+			}
+		}
+	}
+}
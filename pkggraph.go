@@ -0,0 +1,221 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var pkggraphCmd = &cobra.Command{
+	Use:   "pkggraph",
+	Short: "package dependency related commands",
+}
+
+var pkggraphMatrixCmd = &cobra.Command{
+	Use:   "matrix",
+	Short: "display the modules that are imported for each build target",
+	Long: `display the modules that provide the packages imported, directly or
+indirectly, by the packages specified by --packages for each of the GOOS/GOARCH
+build targets specified by --targets, taking --tags into account. Only the
+modules that are not imported for every target are displayed. go list is used
+to load the packages for each target, no cross compilers are required and no
+network access is needed if the modules are in the module cache.`,
+	Args: cobra.NoArgs,
+	RunE: pkggraphMatrix,
+}
+
+func init() {
+	rootCmd.AddCommand(pkggraphCmd)
+	pkggraphCmd.AddCommand(pkggraphMatrixCmd)
+	for _, group := range []string{"go", "build", "out"} {
+		must(pflagvar.RegisterFlagsInStruct(pkggraphCmd.PersistentFlags(), group, &graphState, nil, nil))
+	}
+	must(pflagvar.RegisterFlagsInStruct(pkggraphMatrixCmd.Flags(), "pkggraph", &graphState, nil, nil))
+	pkggraphCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		moduleDiagnostics = &diagnostics{}
+		writeOutputTo(cmd)
+	}
+	pkggraphCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		moduleDiagnostics.summary(cmd.ErrOrStderr())
+	}
+}
+
+type buildTarget struct {
+	GOOS, GOARCH string
+}
+
+func (bt buildTarget) String() string {
+	return bt.GOOS + "/" + bt.GOARCH
+}
+
+// parseTargets parses a comma separated list of GOOS/GOARCH targets.
+func parseTargets(spec string) ([]buildTarget, error) {
+	targets := []buildTarget{}
+	for _, t := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(t), "/")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("invalid build target %q, must be of the form GOOS/GOARCH", t)
+		}
+		targets = append(targets, buildTarget{GOOS: parts[0], GOARCH: parts[1]})
+	}
+	return targets, nil
+}
+
+// packageListFormat is the go list -f template used by packageModules.
+// Package errors are quoted since they may span multiple lines.
+const packageListFormat = `{{with .Module}}{{if not .Main}}{{.Path}}{{end}}{{end}}{{with .Error}}
+error {{printf "%q" (print $.ImportPath ": " .Err)}}{{end}}`
+
+// packageModules returns the modules, other than the main module, that
+// provide the packages imported by the specified packages, as reported
+// by go list -deps with the supplied flags, and the errors encountered
+// loading those packages. go list -e reports such errors rather than
+// failing and hence the modules returned may be incomplete.
+func packageModules(ctx context.Context, gc goCmd, flags []string, packages []string) (map[string]bool, []string, error) {
+	args := append([]string{"list", "-e", "-deps"}, flags...)
+	args = append(args, "-f", packageListFormat)
+	output, err := gc.output(ctx, append(args, packages...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsePackageModules(bytes.NewBuffer(output))
+}
+
+// parsePackageModules parses the output of go list with packageListFormat.
+func parsePackageModules(rd io.Reader) (map[string]bool, []string, error) {
+	modules := map[string]bool{}
+	errs := []string{}
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if quoted := strings.TrimPrefix(line, "error "); quoted != line {
+			if msg, err := strconv.Unquote(quoted); err == nil {
+				errs = append(errs, msg)
+				continue
+			}
+		}
+		if len(line) > 0 {
+			modules[line] = true
+		}
+	}
+	return modules, errs, sc.Err()
+}
+
+// targetModules returns the modules, other than the main module, that
+// provide the packages imported by the specified packages for target.
+// Errors loading those packages are recorded as diagnostics.
+func targetModules(ctx context.Context, target buildTarget, packages []string) (map[string]bool, error) {
+	gc := goCmd{Env: []string{"GOOS=" + target.GOOS, "GOARCH=" + target.GOARCH}}
+	modules, errs, err := packageModules(ctx, gc, nil, packages)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", target, err)
+	}
+	for _, e := range errs {
+		moduleDiagnostics.addPackageError(target.String() + ": " + e)
+	}
+	return modules, nil
+}
+
+// targetMatrix records the modules imported for each of a set of build
+// targets.
+type targetMatrix struct {
+	targets []buildTarget
+	modules map[string][]bool // indexed by target.
+}
+
+func newTargetMatrix(ctx context.Context, targets []buildTarget, packages []string) (*targetMatrix, error) {
+	tm := &targetMatrix{targets: targets, modules: map[string][]bool{}}
+	for i, target := range targets {
+		modules, err := targetModules(ctx, target, packages)
+		if err != nil {
+			return nil, err
+		}
+		for m := range modules {
+			if tm.modules[m] == nil {
+				tm.modules[m] = make([]bool, len(targets))
+			}
+			tm.modules[m][i] = true
+		}
+	}
+	return tm, nil
+}
+
+// partial returns the modules that are not imported for every target,
+// sorted by the number of targets they are imported for and then by name,
+// and the number of modules that are imported for every target.
+func (tm *targetMatrix) partial() ([]string, int) {
+	count := func(m string) int {
+		n := 0
+		for _, imported := range tm.modules[m] {
+			if imported {
+				n++
+			}
+		}
+		return n
+	}
+	partial, all := []string{}, 0
+	for m := range tm.modules {
+		if count(m) == len(tm.targets) {
+			all++
+			continue
+		}
+		partial = append(partial, m)
+	}
+	sort.Slice(partial, func(i, j int) bool {
+		if ci, cj := count(partial[i]), count(partial[j]); ci != cj {
+			return ci < cj
+		}
+		return partial[i] < partial[j]
+	})
+	return partial, all
+}
+
+func pkggraphMatrix(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	targets, err := parseTargets(graphState.Targets)
+	if err != nil {
+		return err
+	}
+	packages := strings.Fields(graphState.Packages)
+	tm, err := newTargetMatrix(ctx, targets, packages)
+	if err != nil {
+		return err
+	}
+	partial, all := tm.partial()
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "%v modules are imported for all %v targets, %v only for some\n", all, len(targets), len(partial))
+	if len(partial) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "module")
+	for _, t := range targets {
+		fmt.Fprintf(tw, "\t%v", t)
+	}
+	fmt.Fprintln(tw)
+	for _, m := range partial {
+		fmt.Fprintf(tw, "%v", m)
+		for _, imported := range tm.modules[m] {
+			if imported {
+				fmt.Fprintf(tw, "\tx")
+			} else {
+				fmt.Fprintf(tw, "\t-")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePackageModules(t *testing.T) {
+	output := `example.com/a
+
+example.com/b
+error "example.com/app/x: no Go files in /src/x"
+example.com/a
+error "example.com/app/y: cannot find module providing package example.com/c/y:\n\tgo.mod has no requirement"
+`
+	modules, errs, err := parsePackageModules(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := modules, map[string]bool{"example.com/a": true, "example.com/b": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := errs, []string{
+		"example.com/app/x: no Go files in /src/x",
+		"example.com/app/y: cannot find module providing package example.com/c/y:\n\tgo.mod has no requirement",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
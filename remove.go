@@ -0,0 +1,131 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphRemoveCmd = &cobra.Command{
+	Use:   "remove <module> [<dependency>]",
+	Short: "report the modules that would no longer be required if a module, or a single dependency, were removed",
+	Long: `report the modules that would no longer be required if a module, or a
+single dependency, were removed from the graph. With one argument the module
+and all of its edges are removed, with two arguments only the edge from the
+first module to the second is removed. The modules that are no longer
+reachable from the root are reported, as are the dependencies of the removed
+module, or edge, that remain reachable via other paths. go.mod is not
+modified.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: graphRemove,
+}
+
+func init() {
+	graphCmd.AddCommand(graphRemoveCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphRemoveCmd.Flags(), "graph", &graphState, nil, nil))
+}
+
+// removal records the effect of removing a module, or an edge, from
+// the graph.
+type removal struct {
+	Reachable int      // modules reachable from the root before the removal.
+	Dropped   []string // modules that are no longer reachable.
+	Retained  []string // dependencies of the removed module, or edge, that remain reachable.
+}
+
+// remove computes the effect of removing module, or if dependsOn is
+// specified, the edge from module to dependsOn, on the modules reachable
+// from root. The graph itself is not modified.
+func (gr *graph) remove(root, module, dependsOn string) (*removal, error) {
+	if gr.nodes[module] == nil {
+		return nil, fmt.Errorf("unrecognised module: %v", module)
+	}
+	dependencies := func(gn *graphNode) []*graphNode { return gn.dependencies }
+	removed := gr.reachable(module, dependencies)
+	removed[module] = true
+	without := func(gn *graphNode) []*graphNode {
+		if gn.module == module && len(dependsOn) == 0 {
+			return nil
+		}
+		deps := make([]*graphNode, 0, len(gn.dependencies))
+		for _, dep := range gn.dependencies {
+			if dep.module == module && len(dependsOn) == 0 {
+				continue
+			}
+			if gn.module == module && dep.module == dependsOn {
+				continue
+			}
+			deps = append(deps, dep)
+		}
+		return deps
+	}
+	if len(dependsOn) > 0 {
+		found := false
+		for _, dep := range gr.nodes[module].dependencies {
+			found = found || dep.module == dependsOn
+		}
+		if !found {
+			return nil, fmt.Errorf("%v does not depend on %v", module, dependsOn)
+		}
+		removed = gr.reachable(dependsOn, dependencies)
+		removed[dependsOn] = true
+	}
+	before := gr.reachable(root, dependencies)
+	after := gr.reachable(root, without)
+	r := &removal{Reachable: len(before)}
+	for m := range before {
+		if after[m] {
+			if removed[m] {
+				r.Retained = append(r.Retained, m)
+			}
+			continue
+		}
+		r.Dropped = append(r.Dropped, m)
+	}
+	sort.Strings(r.Dropped)
+	sort.Strings(r.Retained)
+	return r, nil
+}
+
+func graphRemove(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	graph, root, grp, err := loadQueryGraph(ctx, "", graphState.Versioned)
+	if err != nil {
+		return err
+	}
+	module, dependsOn := args[0], ""
+	if len(args) == 2 {
+		dependsOn = args[1]
+	}
+	if grp != nil {
+		module = grp(module)
+		if len(dependsOn) > 0 {
+			dependsOn = grp(dependsOn)
+		}
+	}
+	r, err := graph.remove(root, module, dependsOn)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	removed := module
+	if len(dependsOn) > 0 {
+		removed = module + " -> " + dependsOn
+	}
+	fmt.Fprintf(out, "removing %v would drop %v of %v modules:\n", removed, len(r.Dropped), r.Reachable)
+	for _, m := range r.Dropped {
+		fmt.Fprintf(out, "  %v\n", m)
+	}
+	fmt.Fprintf(out, "still reachable via other paths (%v):\n", len(r.Retained))
+	for _, m := range r.Retained {
+		fmt.Fprintf(out, "  %v\n", m)
+	}
+	return nil
+}
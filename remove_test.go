@@ -0,0 +1,78 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	for _, tc := range []struct {
+		fixture           string
+		module, dependsOn string
+		removal           *removal
+		err               string
+	}{
+		{"small", "example.com/a", "", &removal{
+			Reachable: 4,
+			Dropped:   []string{"example.com/a"},
+			Retained:  []string{"example.com/c", "golang.org/x/text"},
+		}, ""},
+		{"small", "example.com/b", "", &removal{
+			Reachable: 4,
+			Dropped:   []string{"example.com/b"},
+			Retained:  []string{"example.com/c", "golang.org/x/text"},
+		}, ""},
+		{"small", "example.com/c", "", &removal{
+			Reachable: 4,
+			Dropped:   []string{"example.com/c"},
+			Retained:  []string{"golang.org/x/text"},
+		}, ""},
+		{"small", "example.com/app", "example.com/a", &removal{
+			Reachable: 4,
+			Dropped:   []string{"example.com/a"},
+			Retained:  []string{"example.com/c", "golang.org/x/text"},
+		}, ""},
+		{"small", "example.com/b", "example.com/c", &removal{
+			Reachable: 4,
+			Retained:  []string{"example.com/c", "golang.org/x/text"},
+		}, ""},
+		// w is only reachable via the cycle through y and z.
+		{"cyclic", "example.com/y", "", &removal{
+			Reachable: 4,
+			Dropped:   []string{"example.com/y", "example.com/z"},
+			Retained:  []string{"example.com/w", "example.com/x"},
+		}, ""},
+		{"cyclic", "example.com/x", "example.com/w", &removal{
+			Reachable: 4,
+			Dropped:   []string{"example.com/w"},
+		}, ""},
+		{"cyclic", "example.com/z", "example.com/x", &removal{
+			Reachable: 4,
+			Retained:  []string{"example.com/w", "example.com/x", "example.com/y", "example.com/z"},
+		}, ""},
+		{"small", "example.com/unknown", "", nil, "unrecognised module: example.com/unknown"},
+		{"small", "example.com/a", "example.com/b", nil, "example.com/a does not depend on example.com/b"},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		gr, _ := fx.graph(t, false)
+		r, err := gr.remove(fx.root, tc.module, tc.dependsOn)
+		if len(tc.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%v: %v %v: unexpected or missing error: %v", tc.fixture, tc.module, tc.dependsOn, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v %v: %v", tc.fixture, tc.module, tc.dependsOn, err)
+			continue
+		}
+		if got, want := r, tc.removal; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: %v %v: got %+v, want %+v", tc.fixture, tc.module, tc.dependsOn, got, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphRenderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "render the dependency graph as an svg or png image without requiring graphviz",
+	Long: `render the dependency graph as an svg or png image using a layered
+layout computed internally, that is, without requiring graphviz to be
+installed. The format is specified by --format or the extension of --out
+and defaults to svg.
+Edges that are part of a cycle are drawn in red and if --group-by is
+specified modules are colored by group.`,
+	RunE: graphRender,
+}
+
+func init() {
+	graphCmd.AddCommand(graphRenderCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphRenderCmd.Flags(), "graph", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(graphRenderCmd.Flags(), "render", &graphState, nil, nil))
+}
+
+var (
+	renderRootColor  = color.RGBA{0xE9, 0x47, 0x62, 0xff}
+	renderNodeColor  = color.RGBA{0xee, 0xee, 0xee, 0xff}
+	renderEdgeColor  = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	renderCycleColor = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	renderTextColor  = color.RGBA{0x00, 0x00, 0x00, 0xff}
+)
+
+// renderedNode and renderedEdge are the layout results annotated with
+// colors, as used by both the svg and png renderers.
+type renderedNode struct {
+	Module              string
+	X, Y, Width, Height float64
+	Fill                color.RGBA
+}
+
+type renderedEdge struct {
+	Points []layoutPoint
+	Stroke color.RGBA
+	Cycle  bool
+}
+
+type rendering struct {
+	Width, Height float64
+	Nodes         []renderedNode
+	Edges         []renderedEdge
+}
+
+func newRendering(dependencies []dependency, unique map[string]bool, ordered []string, grp grouper) (*rendering, error) {
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return nil, err
+	}
+	components := graph.components()
+	ll := newLayeredLayout(dependencies, ordered)
+	rd := &rendering{Width: ll.width, Height: ll.height}
+	groups := map[string]int{}
+	if grp != nil {
+		for _, m := range ordered {
+			if _, ok := groups[grp(m)]; !ok {
+				groups[grp(m)] = len(groups)
+			}
+		}
+	}
+	for i, nd := range ll.nodes {
+		if len(nd.module) == 0 {
+			continue
+		}
+		rn := renderedNode{
+			Module: nd.module,
+			X:      nd.x - nd.width/2,
+			Y:      nd.y - layoutNodeHeight/2,
+			Width:  nd.width,
+			Height: layoutNodeHeight,
+			Fill:   renderNodeColor,
+		}
+		switch {
+		case i == 0:
+			rn.Fill = renderRootColor
+		case grp != nil:
+			rn.Fill = hslColor(float64(groups[grp(nd.module)])/float64(len(groups)), 0.9, 0.8)
+		}
+		rd.Nodes = append(rd.Nodes, rn)
+	}
+	for _, le := range ll.edges {
+		re := renderedEdge{Points: le.points, Stroke: renderEdgeColor}
+		if components[le.Module] == components[le.DependsOn] {
+			re.Stroke, re.Cycle = renderCycleColor, true
+		}
+		rd.Edges = append(rd.Edges, re)
+	}
+	return rd, nil
+}
+
+// hslColor converts hue, saturation and lightness, all in the range
+// 0..1, to RGB.
+func hslColor(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	hp := h * 6
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+	var r, g, b float64
+	switch {
+	case hp < 1:
+		r, g = c, x
+	case hp < 2:
+		r, g = x, c
+	case hp < 3:
+		g, b = c, x
+	case hp < 4:
+		g, b = x, c
+	case hp < 5:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := l - c/2
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 0xff}
+}
+
+var renderSVGTpl = template.Must(template.New("svg").Funcs(template.FuncMap{
+	"rgb": rgbColor,
+	"points": func(pts []layoutPoint) string {
+		s := ""
+		for i, p := range pts {
+			if i > 0 {
+				s += " "
+			}
+			s += fmt.Sprintf("%.1f,%.1f", p.X, p.Y)
+		}
+		return s
+	},
+}).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{printf "%.0f" .Width}}" height="{{printf "%.0f" .Height}}" viewBox="0 0 {{printf "%.0f" .Width}} {{printf "%.0f" .Height}}">
+<defs>
+  <marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0L10,5L0,10z" fill="#999999"/></marker>
+  <marker id="arrow-cycle" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0L10,5L0,10z" fill="#ff0000"/></marker>
+</defs>
+<rect width="100%" height="100%" fill="#ffffff"/>
+{{range .Edges}}<polyline points="{{points .Points}}" fill="none" stroke="{{rgb .Stroke}}" marker-end="url(#{{if .Cycle}}arrow-cycle{{else}}arrow{{end}})"/>
+{{end}}{{range .Nodes}}<g><title>{{html .Module}}</title><rect x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" width="{{printf "%.1f" .Width}}" height="{{printf "%.1f" .Height}}" fill="{{rgb .Fill}}" stroke="#666666"/><text x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" dx="10" dy="14" font-family="monospace" font-size="11">{{html .Module}}</text></g>
+{{end}}</svg>
+`))
+
+func (rd *rendering) writeSVG(out io.Writer) error {
+	return renderSVGTpl.Execute(out, rd)
+}
+
+func (rd *rendering) writePNG(out io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(rd.Width)), int(math.Ceil(rd.Height))))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for _, e := range rd.Edges {
+		for i := 1; i < len(e.Points); i++ {
+			drawLine(img, e.Points[i-1], e.Points[i], e.Stroke)
+		}
+		drawArrowHead(img, e.Points[len(e.Points)-2], e.Points[len(e.Points)-1], e.Stroke)
+	}
+	face := basicfont.Face7x13
+	for _, n := range rd.Nodes {
+		r := image.Rect(int(n.X), int(n.Y), int(n.X+n.Width), int(n.Y+n.Height))
+		draw.Draw(img, r, image.NewUniform(n.Fill), image.Point{}, draw.Src)
+		border := color.RGBA{0x66, 0x66, 0x66, 0xff}
+		drawLine(img, layoutPoint{n.X, n.Y}, layoutPoint{n.X + n.Width, n.Y}, border)
+		drawLine(img, layoutPoint{n.X, n.Y + n.Height}, layoutPoint{n.X + n.Width, n.Y + n.Height}, border)
+		drawLine(img, layoutPoint{n.X, n.Y}, layoutPoint{n.X, n.Y + n.Height}, border)
+		drawLine(img, layoutPoint{n.X + n.Width, n.Y}, layoutPoint{n.X + n.Width, n.Y + n.Height}, border)
+		d := font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(renderTextColor),
+			Face: face,
+			Dot:  fixed.P(int(n.X)+layoutNodePadding, int(n.Y)+14),
+		}
+		d.DrawString(n.Module)
+	}
+	return png.Encode(out, img)
+}
+
+// drawLine draws a line using a simple digital differential analyzer.
+func drawLine(img *image.RGBA, from, to layoutPoint, c color.RGBA) {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	steps := math.Max(math.Abs(dx), math.Abs(dy))
+	if steps < 1 {
+		steps = 1
+	}
+	for i := 0.0; i <= steps; i++ {
+		img.SetRGBA(int(from.X+dx*i/steps), int(from.Y+dy*i/steps), c)
+	}
+}
+
+func drawArrowHead(img *image.RGBA, from, to layoutPoint, c color.RGBA) {
+	const length, spread = 8.0, 0.4
+	angle := math.Atan2(to.Y-from.Y, to.X-from.X)
+	for _, a := range []float64{angle + math.Pi - spread, angle + math.Pi + spread} {
+		end := layoutPoint{to.X + length*math.Cos(a), to.Y + length*math.Sin(a)}
+		drawLine(img, to, end, c)
+	}
+}
+
+func graphRender(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	dependencies, unique, ordered, err := getGraph(ctx, graphState.Versioned)
+	if err != nil {
+		return err
+	}
+	grp, err := newGrouper(graphState.GroupBy)
+	if err != nil {
+		return err
+	}
+	rd, err := newRendering(dependencies, unique, ordered, grp)
+	if err != nil {
+		return err
+	}
+	format := graphState.RenderFormat
+	if len(format) == 0 {
+		format = strings.TrimPrefix(filepath.Ext(graphState.Out), ".")
+	}
+	switch format {
+	case "svg", "":
+		return rd.writeSVG(cmd.OutOrStdout())
+	case "png":
+		return rd.writePNG(cmd.OutOrStdout())
+	}
+	return fmt.Errorf("unsupported image format %q, use svg or png", format)
+}
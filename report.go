@@ -0,0 +1,218 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "generate a static site with visualizations, statistics and data files for the dependency graph",
+	Long: `generate a self contained static site in the directory specified by
+--report-dir that contains an index page with a summary of the graph and the
+statistics for each module, the dependency wheel, interactive tree and force
+directed graph visualizations and the underlying data as json files. The site
+can be viewed locally or published, eg. as a CI artifact. As for all other
+commands, --dir specifies the directory containing the module to analyze.`,
+	Args: cobra.NoArgs,
+	RunE: graphReport,
+}
+
+func init() {
+	graphCmd.AddCommand(graphReportCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphReportCmd.Flags(), "graph", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(graphReportCmd.Flags(), "report", &graphState, nil, nil))
+}
+
+// reportStats are the statistics for each module, or group, and the
+// modules in the order in which they first appear. They are computed once
+// by graphReport for all of the files that include them.
+type reportStats struct {
+	stats   []moduleStats
+	ordered []string
+}
+
+// reportFile is a file in the report, other than the index page.
+type reportFile struct {
+	Name        string
+	Description string
+	write       func(ctx context.Context, out io.Writer, rs *reportStats) error
+}
+
+// withoutStats adapts a function that writes a file that does not include
+// the statistics.
+func withoutStats(write func(ctx context.Context, out io.Writer) error) func(context.Context, io.Writer, *reportStats) error {
+	return func(ctx context.Context, out io.Writer, _ *reportStats) error {
+		return write(ctx, out)
+	}
+}
+
+// writeJSON returns a function that writes the value returned by load
+// as indented json.
+func writeJSON(load func(ctx context.Context, rs *reportStats) (interface{}, error)) func(context.Context, io.Writer, *reportStats) error {
+	return func(ctx context.Context, out io.Writer, rs *reportStats) error {
+		v, err := load(ctx, rs)
+		if err != nil {
+			return err
+		}
+		buf, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(append(buf, '\n'))
+		return err
+	}
+}
+
+var reportFiles = []reportFile{
+	{"wheel.html", "dependency wheel", withoutStats(writeDependencyWheel)},
+	{"itree.html", "interactive tree of dependencies and dependents", withoutStats(writeDependencyTree)},
+	{"force.html", "force directed graph", withoutStats(writeForceGraph)},
+	{"stats.txt", "direct and transitive dependencies and dependents of each module", func(ctx context.Context, out io.Writer, rs *reportStats) error {
+		return writeStats(ctx, out, rs.stats, rs.ordered)
+	}},
+	{"graph.jsonl", "modules and requirements, one json object per line", withoutStats(func(ctx context.Context, out io.Writer) error {
+		graph, err := loadAnnotatedGraph(ctx, true, true)
+		if err != nil {
+			return err
+		}
+		return exportJSONL(out, graph)
+	})},
+	{"itree.json", "dependency and dependent trees", writeJSON(func(ctx context.Context, _ *reportStats) (interface{}, error) {
+		trees, _, err := loadTreesJS(ctx)
+		return trees, err
+	})},
+	{"force.json", "nodes and links of the force directed graph", writeJSON(func(ctx context.Context, _ *reportStats) (interface{}, error) {
+		fd, _, err := loadForceData(ctx)
+		return fd, err
+	})},
+	{"stats.json", "direct and transitive dependencies and dependents of each module", writeJSON(func(ctx context.Context, rs *reportStats) (interface{}, error) {
+		return rs.stats, nil
+	})},
+}
+
+func createReportFile(filename string, write func(out io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func graphReport(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	dir := graphState.ReportDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Load the raw, versioned, graph first so that go mod graph is only run
+	// once for all of the report files.
+	if _, _, _, err := getGraph(ctx, true); err != nil {
+		return err
+	}
+	// The statistics are computed once for the index and the stats files.
+	graph, root, _, err := loadQueryGraph(ctx, "", graphState.Versioned)
+	if err != nil {
+		return err
+	}
+	_, _, ordered, err := getGraph(ctx, graphState.Versioned)
+	if err != nil {
+		return err
+	}
+	rs := &reportStats{stats: graph.stats(), ordered: ordered}
+	for _, rf := range reportFiles {
+		err := createReportFile(filepath.Join(dir, rf.Name), func(out io.Writer) error {
+			return rf.write(ctx, out, rs)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	dependencies := 0
+	for _, gn := range graph.nodes {
+		dependencies += len(gn.dependencies)
+	}
+	data := struct {
+		Root         string
+		Modules      int
+		Dependencies int
+		Cycles       int
+		Diagnostics  *diagnostics
+		Files        []reportFile
+		Stats        []moduleStats
+	}{
+		Root:         root,
+		Modules:      len(graph.nodes),
+		Dependencies: dependencies,
+		Cycles:       len(graph.cycles()),
+		Diagnostics:  moduleDiagnostics.orNil(),
+		Files:        reportFiles,
+		Stats:        rs.stats,
+	}
+	return createReportFile(filepath.Join(dir, "index.html"), func(out io.Writer) error {
+		return reportIndexTmpl.Execute(out, &data)
+	})
+}
+
+var reportIndexTmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<meta charset="utf-8">
+<title>Dependencies of {{.Root}}</title>
+<style type="text/css">
+body {
+  font-family: sans-serif;
+  margin: 2em;
+}
+table {
+  border-collapse: collapse;
+}
+th, td {
+  padding: 2px 12px;
+  text-align: left;
+}
+tr:nth-child(even) {
+  background-color: #EEE;
+}
+td.number {
+  text-align: right;
+}
+.warning {
+  color: #D62728;
+}
+</style>
+<body>
+<h1>Dependencies of {{.Root}}</h1>
+<p>{{.Modules}} modules, {{.Dependencies}} dependencies, {{.Cycles}} cycles.</p>
+{{- with .Diagnostics}}
+<p class="warning">The output of go mod graph contained {{len .Malformed}} malformed line(s)
+and {{len .Unrecognised}} unrecognised module(s), go list reported {{len .PackageErrors}}
+package error(s) and {{len .InvalidGoMods}} go.mod file(s) could not be parsed, see graph.jsonl.</p>
+{{- end}}
+<ul>
+{{- range .Files}}
+  <li><a href="{{.Name}}">{{.Name}}</a>: {{.Description}}</li>
+{{- end}}
+</ul>
+<table>
+<tr><th>module</th><th>dependencies</th><th>dependents</th><th>transitive</th></tr>
+{{- range .Stats}}
+<tr><td>{{.Module}}</td><td class="number">{{.Dependencies}}</td><td class="number">{{.Dependents}}</td><td class="number">{{.TransitiveDependencies}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,140 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"v.io/x/lib/cmd/pflagvar"
+)
+
+var graphStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "display summary statistics for each module, or group, in the dependency graph",
+	RunE:  graphStats,
+}
+
+func init() {
+	graphCmd.AddCommand(graphStatsCmd)
+	must(pflagvar.RegisterFlagsInStruct(graphStatsCmd.Flags(), "graph", &graphState, nil, nil))
+}
+
+type moduleStats struct {
+	Module                 string
+	Dependencies           int
+	Dependents             int
+	TransitiveDependencies int
+}
+
+// reachable returns the set of nodes reachable from the specified module,
+// not including the module itself.
+func (gr *graph) reachable(module string, follow func(gn *graphNode) []*graphNode) map[string]bool {
+	visited := map[string]bool{}
+	gn := gr.nodes[module]
+	if gn == nil {
+		return visited
+	}
+	stack := []*graphNode{gn}
+	for len(stack) > 0 {
+		gn := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, n := range follow(gn) {
+			if !visited[n.module] && n.module != module {
+				visited[n.module] = true
+				stack = append(stack, n)
+			}
+		}
+	}
+	return visited
+}
+
+func (gr *graph) stats() []moduleStats {
+	stats := make([]moduleStats, 0, len(gr.nodes))
+	for k, gn := range gr.nodes {
+		stats = append(stats, moduleStats{
+			Module:                 k,
+			Dependencies:           len(gn.dependencies),
+			Dependents:             len(gn.dependents),
+			TransitiveDependencies: len(gr.reachable(k, func(gn *graphNode) []*graphNode { return gn.dependencies })),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TransitiveDependencies == stats[j].TransitiveDependencies {
+			return stats[i].Module < stats[j].Module
+		}
+		return stats[i].TransitiveDependencies > stats[j].TransitiveDependencies
+	})
+	return stats
+}
+
+// loadStats returns the statistics for each module, or group if --group-by
+// is specified, and the modules in the order in which they first appear.
+func loadStats(ctx context.Context) ([]moduleStats, []string, error) {
+	dependencies, unique, ordered, err := getGraph(ctx, graphState.Versioned)
+	if err != nil {
+		return nil, nil, err
+	}
+	grp, err := newGrouper(graphState.GroupBy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if grp != nil {
+		dependencies, unique, _ = groupDependencies(dependencies, ordered, grp)
+	}
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return nil, nil, err
+	}
+	return graph.stats(), ordered, nil
+}
+
+func graphStats(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	stats, ordered, err := loadStats(ctx)
+	if err != nil {
+		return err
+	}
+	return writeStats(ctx, cmd.OutOrStdout(), stats, ordered)
+}
+
+// writeStats writes the statistics as a table that includes the metadata
+// of each of the ordered modules if --metadata is specified.
+func writeStats(ctx context.Context, out io.Writer, stats []moduleStats, ordered []string) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if !graphState.Metadata {
+		fmt.Fprintf(tw, "module\tdependencies\tdependents\ttransitive\n")
+		for _, s := range stats {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", s.Module, s.Dependencies, s.Dependents, s.TransitiveDependencies)
+		}
+		return tw.Flush()
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	metadata, err := loadMetadata(ctx, ordered, selected)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(tw, "module\tdependencies\tdependents\ttransitive\tgo\treleased\tpackages\tsize\tdeprecated\tretracted\n")
+	for _, s := range stats {
+		md := metadata[s.Module]
+		if md == nil {
+			md = &moduleMetadata{}
+		}
+		released := ""
+		if !md.Time.IsZero() {
+			released = md.Time.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", s.Module, s.Dependencies, s.Dependents, s.TransitiveDependencies,
+			md.GoVersion, released, md.Packages, md.Size, len(md.Deprecated) > 0, md.Retracted)
+	}
+	return tw.Flush()
+}
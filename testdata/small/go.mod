@@ -0,0 +1,15 @@
+module example.com/app
+
+go 1.17
+
+require (
+	example.com/a v1.0.0
+	example.com/b v1.1.0
+)
+
+require (
+	example.com/c v1.3.0 // indirect
+	golang.org/x/text v0.3.7 // indirect
+)
+
+tool example.com/b/cmd/gen
@@ -0,0 +1,7 @@
+//go:build tools
+
+package tools
+
+import (
+	_ "golang.org/x/text/cmd/gotext"
+)
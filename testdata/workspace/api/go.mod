@@ -0,0 +1,5 @@
+module example.com/ws/api
+
+go 1.21
+
+require example.com/ws/shared v0.0.0
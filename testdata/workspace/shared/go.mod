@@ -0,0 +1,7 @@
+module example.com/ws/shared
+
+go 1.21
+
+require golang.org/x/mod v0.20.0
+
+require golang.org/x/tools v0.13.0 // indirect
@@ -0,0 +1,262 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// moduleUsage records how the packages of the main module use a module.
+type moduleUsage string
+
+const (
+	usageProduction moduleUsage = "production" // imported by non-test packages.
+	usageTest       moduleUsage = "test"       // only imported by tests.
+	usageTool       moduleUsage = "tool"       // only imported by tools.
+	usageUnimported moduleUsage = "unimported" // required, but not imported.
+)
+
+var moduleUsages = []moduleUsage{usageProduction, usageTest, usageTool, usageUnimported}
+
+// toolDirectives returns the packages named by the tool directives in
+// a go.mod file. The syntax tree is used since modfile.ParseLax ignores
+// tool directives.
+func toolDirectives(f *modfile.File) []string {
+	tools := []string{}
+	if f == nil || f.Syntax == nil {
+		return tools
+	}
+	for _, stmt := range f.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			if len(x.Token) == 2 && x.Token[0] == "tool" {
+				tools = append(tools, x.Token[1])
+			}
+		case *modfile.LineBlock:
+			if len(x.Token) == 1 && x.Token[0] == "tool" {
+				for _, l := range x.Line {
+					if len(l.Token) == 1 {
+						tools = append(tools, l.Token[0])
+					}
+				}
+			}
+		}
+	}
+	return tools
+}
+
+// isToolsFile returns true if f is constrained by the tools build tag,
+// ie. it is only built when that tag is specified.
+func isToolsFile(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				continue
+			}
+			with := expr.Eval(func(tag string) bool { return tag == "tools" })
+			without := expr.Eval(func(tag string) bool { return false })
+			if with && !without {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toolsGoImports returns the packages imported by the tools.go files,
+// the convention used to track tool dependencies before tool directives
+// were available, in the main module. Only files with the tools build
+// constraint are considered and those that cannot be parsed are ignored.
+// Nested modules, vendor and testdata directories are skipped.
+func toolsGoImports(dir string) ([]string, error) {
+	imports := []string{}
+	if len(dir) == 0 {
+		return imports, nil
+	}
+	fset := token.NewFileSet()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path == dir {
+				return nil
+			}
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() != "tools.go" {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly|parser.ParseComments)
+		if err != nil || !isToolsFile(f) {
+			return nil
+		}
+		for _, spec := range f.Imports {
+			if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+				imports = append(imports, p)
+			}
+		}
+		return nil
+	})
+	return imports, err
+}
+
+// toolPackages returns the tool packages used by the main module.
+func toolPackages(mc *modCache, root string) ([]string, error) {
+	f, err := mc.goMod(root)
+	if err != nil {
+		return nil, err
+	}
+	imports, err := toolsGoImports(mc.moddir)
+	if err != nil {
+		return nil, err
+	}
+	tools := append(toolDirectives(f), imports...)
+	sort.Strings(tools)
+	return tools, nil
+}
+
+// loadUsage classifies each of the supplied modules, which may be
+// versioned, by loading the packages of the main module without and then
+// with their tests and the tool packages it uses. Versions other than the
+// selected one are unimported. Modules that are neither versioned,
+// selected nor the root, eg. groups, are not classified. The result is
+// not cached since it depends on the source code rather than go.mod.
+// Errors loading packages are recorded as diagnostics.
+func loadUsage(ctx context.Context, modules []string, selected map[string]string) (map[string]moduleUsage, error) {
+	root, err := getRoot(ctx, goCmd{})
+	if err != nil {
+		return nil, err
+	}
+	mc, err := newModCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+	load := func(flags, packages []string) (map[string]bool, error) {
+		modules, errs, err := packageModules(ctx, goCmd{}, flags, packages)
+		for _, e := range errs {
+			moduleDiagnostics.addPackageError(e)
+		}
+		return modules, err
+	}
+	production, err := load(nil, []string{"./..."})
+	if err != nil {
+		return nil, err
+	}
+	test, err := load([]string{"-test"}, []string{"./..."})
+	if err != nil {
+		return nil, err
+	}
+	tools, err := toolPackages(mc, root)
+	if err != nil {
+		return nil, err
+	}
+	tool := map[string]bool{}
+	if len(tools) > 0 {
+		if tool, err = load(nil, tools); err != nil {
+			return nil, err
+		}
+	}
+	usage := make(map[string]moduleUsage, len(modules))
+	for _, m := range modules {
+		if isPseudoModule(m) {
+			continue
+		}
+		path := stripVersion(m)
+		if m == root {
+			usage[m] = usageProduction
+			continue
+		}
+		version, ok := selected[path]
+		if !ok && path == m {
+			continue
+		}
+		switch {
+		case ok && version != moduleVersion(m, selected):
+			usage[m] = usageUnimported
+		case production[path]:
+			usage[m] = usageProduction
+		case test[path]:
+			usage[m] = usageTest
+		case tool[path]:
+			usage[m] = usageTool
+		default:
+			usage[m] = usageUnimported
+		}
+	}
+	return usage, nil
+}
+
+// usageFilter returns a function that returns true for the usages in
+// the comma separated list spec.
+func usageFilter(spec string) (func(u moduleUsage) bool, error) {
+	match := map[moduleUsage]bool{}
+	for _, u := range strings.Split(spec, ",") {
+		found := false
+		for _, mu := range moduleUsages {
+			if found = moduleUsage(strings.TrimSpace(u)) == mu; found {
+				match[mu] = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid usage: %q, must be one of production, test, tool or unimported", u)
+		}
+	}
+	return func(u moduleUsage) bool { return match[u] }, nil
+}
+
+// filterByUsage restricts the tree to the paths that include a module
+// with one of the usages in spec.
+func filterByUsage(ctx context.Context, tree *treeNode, spec string) (*treeNode, error) {
+	match, err := usageFilter(spec)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return nil, err
+	}
+	modules := map[string]bool{}
+	tree.modules(modules)
+	all := make([]string, 0, len(modules))
+	for m := range modules {
+		all = append(all, m)
+	}
+	usage, err := loadUsage(ctx, all, selected)
+	if err != nil {
+		return nil, err
+	}
+	return filter(tree, func(tn *treeNode) bool {
+		u, ok := usage[tn.Module]
+		return ok && match(u)
+	}, false), nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+func TestToolPackages(t *testing.T) {
+	gomod := `module example.com/app
+
+go 1.24
+
+tool example.com/x/cmd/a
+
+tool (
+	example.com/y/cmd/b
+	example.com/y/cmd/c
+)
+`
+	f, err := modfile.ParseLax("go.mod", []byte(gomod), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := toolDirectives(f), []string{"example.com/x/cmd/a", "example.com/y/cmd/b", "example.com/y/cmd/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", gomod)
+	write("tools/tools.go", "//go:build tools\n\npackage tools\n\nimport _ \"example.com/z/cmd/d\"\n")
+	write("testdata/tools.go", "package tools\n\nimport _ \"example.com/ignored\"\n")
+	write("nested/go.mod", "module example.com/app/nested\n")
+	write("nested/tools.go", "package tools\n\nimport _ \"example.com/ignored\"\n")
+	write("untagged/tools.go", "package tools\n\nimport _ \"example.com/ignored\"\n")
+	write("negated/tools.go", "//go:build !tools\n\npackage tools\n\nimport _ \"example.com/ignored\"\n")
+	write("other/tools.go", "//go:build linux\n\npackage tools\n\nimport _ \"example.com/ignored\"\n")
+	write("legacy/tools.go", "// +build tools\n\npackage tools\n\nimport _ \"example.com/z/cmd/e\"\n")
+	write("broken/tools.go", "//go:build tools\n\npackage tools\n\nimport _ example.com/broken\n")
+	mc := &modCache{
+		gomod:  filepath.Join(dir, "go.mod"),
+		moddir: dir,
+		parsed: map[string]*modfile.File{},
+	}
+	tools, err := toolPackages(mc, "example.com/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tools, []string{"example.com/x/cmd/a", "example.com/y/cmd/b", "example.com/y/cmd/c", "example.com/z/cmd/d", "example.com/z/cmd/e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := usageFilter("test,tool"); err != nil {
+		t.Error(err)
+	}
+	if _, err := usageFilter("test,"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
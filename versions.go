@@ -0,0 +1,134 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+var graphVersionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "display every version of each module that is required anywhere in the graph",
+	Long: `display every version of each module that is required anywhere in the
+graph, the modules that require each version, the version selected by
+minimal version selection and the gap (major, minor, patch or prerelease)
+between the lowest and highest required versions. Modules are sorted with
+the largest gap first.`,
+	RunE: graphVersions,
+}
+
+func init() {
+	graphCmd.AddCommand(graphVersionsCmd)
+}
+
+// versionGaps, in increasing order of size.
+var versionGaps = []string{"none", "prerelease", "patch", "minor", "major"}
+
+// versionGap returns the index in versionGaps of the difference between
+// the two versions.
+func versionGap(lo, hi string) int {
+	release := func(v string) string {
+		return strings.TrimSuffix(semver.Canonical(v), semver.Prerelease(v))
+	}
+	switch {
+	case semver.Major(lo) != semver.Major(hi):
+		return 4
+	case semver.MajorMinor(lo) != semver.MajorMinor(hi):
+		return 3
+	case release(lo) != release(hi):
+		return 2
+	case lo != hi:
+		return 1
+	}
+	return 0
+}
+
+// versionSkew records the versions of a module that are required and
+// by which modules.
+type versionSkew struct {
+	Module     string
+	Selected   string
+	Versions   []string            // sorted in increasing semver order.
+	RequiredBy map[string][]string // indexed by version.
+	Gap        int                 // index into versionGaps.
+}
+
+// versionSkews returns the skew for every module that is required, as
+// computed from a versioned set of dependencies, sorted by decreasing
+// gap and then number of versions.
+func versionSkews(dependencies []dependency, selected map[string]string) []*versionSkew {
+	skews := map[string]*versionSkew{}
+	for _, dep := range dependencies {
+		if isPseudoModule(dep.DependsOn) {
+			continue
+		}
+		path, version := stripVersion(dep.DependsOn), moduleVersion(dep.DependsOn, nil)
+		vs := skews[path]
+		if vs == nil {
+			vs = &versionSkew{
+				Module:     path,
+				Selected:   selected[path],
+				RequiredBy: map[string][]string{},
+			}
+			skews[path] = vs
+		}
+		if _, ok := vs.RequiredBy[version]; !ok {
+			vs.Versions = append(vs.Versions, version)
+		}
+		vs.RequiredBy[version] = append(vs.RequiredBy[version], dep.Module)
+	}
+	sorted := make([]*versionSkew, 0, len(skews))
+	for _, vs := range skews {
+		sort.Slice(vs.Versions, func(i, j int) bool {
+			return semver.Compare(vs.Versions[i], vs.Versions[j]) < 0
+		})
+		for _, by := range vs.RequiredBy {
+			sort.Strings(by)
+		}
+		vs.Gap = versionGap(vs.Versions[0], vs.Versions[len(vs.Versions)-1])
+		sorted = append(sorted, vs)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Gap != b.Gap {
+			return a.Gap > b.Gap
+		}
+		if len(a.Versions) != len(b.Versions) {
+			return len(a.Versions) > len(b.Versions)
+		}
+		return a.Module < b.Module
+	})
+	return sorted
+}
+
+func graphVersions(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	dependencies, _, _, err := getGraph(ctx, true)
+	if err != nil {
+		return err
+	}
+	selected, err := getSelectedVersions(ctx, goCmd{})
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	for _, vs := range versionSkews(dependencies, selected) {
+		fmt.Fprintf(out, "%v: %v versions, %v skew, selected %v\n", vs.Module, len(vs.Versions), versionGaps[vs.Gap], vs.Selected)
+		for _, v := range vs.Versions {
+			marker := " "
+			if v == vs.Selected {
+				marker = "*"
+			}
+			fmt.Fprintf(out, " %v %v required by: %v\n", marker, v, strings.Join(vs.RequiredBy[v], ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVersionGap(t *testing.T) {
+	for _, tc := range []struct {
+		lo, hi string
+		gap    string
+	}{
+		{"v1.2.3", "v1.2.3", "none"},
+		{"v1.2.3-rc.1", "v1.2.3", "prerelease"},
+		{"v1.2.3-rc.1", "v1.2.3-rc.2", "prerelease"},
+		{"v1.2.3", "v1.2.4", "patch"},
+		{"v1.2.3-rc.1", "v1.2.4", "patch"},
+		{"v1.2.3", "v1.3.0", "minor"},
+		{"v0.0.0-20200101000000-abcdefabcdef", "v0.1.0", "minor"},
+		{"v1.2.3", "v2.0.0", "major"},
+		{"v1.9.9", "v2.0.0+incompatible", "major"},
+	} {
+		if got, want := versionGaps[versionGap(tc.lo, tc.hi)], tc.gap; got != want {
+			t.Errorf("%v %v: got %v, want %v", tc.lo, tc.hi, got, want)
+		}
+	}
+}
+
+func TestVersionSkews(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		skews   []*versionSkew
+	}{
+		{"versioned", []*versionSkew{
+			{
+				Module:   "example.com/util",
+				Selected: "v0.3.0",
+				Versions: []string{"v0.1.0", "v0.2.0", "v0.3.0"},
+				RequiredBy: map[string][]string{
+					"v0.1.0": {"example.com/lib@v1.2.0"},
+					"v0.2.0": {"example.com/lib@v1.4.0"},
+					"v0.3.0": {"example.com/app", "example.com/lib/v2@v2.1.0"},
+				},
+				Gap: 3,
+			},
+			{
+				Module:   "example.com/lib",
+				Selected: "v1.4.0",
+				Versions: []string{"v1.2.0", "v1.4.0"},
+				RequiredBy: map[string][]string{
+					"v1.2.0": {"example.com/lib/v2@v2.1.0"},
+					"v1.4.0": {"example.com/app"},
+				},
+				Gap: 3,
+			},
+			{
+				Module:   "example.com/extra",
+				Selected: "v0.0.0-20200101000000-abcdefabcdef",
+				Versions: []string{"v0.0.0-20200101000000-abcdefabcdef"},
+				RequiredBy: map[string][]string{
+					"v0.0.0-20200101000000-abcdefabcdef": {"example.com/util@v0.1.0"},
+				},
+			},
+			{
+				Module:   "example.com/lib/v2",
+				Selected: "v2.1.0",
+				Versions: []string{"v2.1.0"},
+				RequiredBy: map[string][]string{
+					"v2.1.0": {"example.com/app"},
+				},
+			},
+		}},
+		{"cyclic", []*versionSkew{
+			{
+				Module:   "example.com/x",
+				Selected: "v1.0.0",
+				Versions: []string{"v0.5.0", "v1.0.0"},
+				RequiredBy: map[string][]string{
+					"v0.5.0": {"example.com/app@v0.9.0"},
+					"v1.0.0": {"example.com/app", "example.com/z@v1.0.0"},
+				},
+				Gap: 4,
+			},
+			{
+				Module:   "example.com/app",
+				Versions: []string{"v0.9.0"},
+				RequiredBy: map[string][]string{
+					"v0.9.0": {"example.com/z@v1.0.0"},
+				},
+			},
+			{
+				Module:   "example.com/w",
+				Selected: "v1.0.0",
+				Versions: []string{"v1.0.0"},
+				RequiredBy: map[string][]string{
+					"v1.0.0": {"example.com/x@v0.5.0"},
+				},
+			},
+			{
+				Module:   "example.com/y",
+				Selected: "v1.0.0",
+				Versions: []string{"v1.0.0"},
+				RequiredBy: map[string][]string{
+					"v1.0.0": {"example.com/app", "example.com/x@v1.0.0"},
+				},
+			},
+			{
+				Module:   "example.com/z",
+				Selected: "v1.0.0",
+				Versions: []string{"v1.0.0"},
+				RequiredBy: map[string][]string{
+					"v1.0.0": {"example.com/y@v1.0.0"},
+				},
+			},
+		}},
+	} {
+		fx := loadFixture(t, tc.fixture)
+		dependencies, _, _ := processGraph(fx.raw, true)
+		if got, want := versionSkews(dependencies, fx.selected), tc.skews; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got:", tc.fixture)
+			for _, vs := range got {
+				t.Errorf("  %+v", vs)
+			}
+		}
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"os"
+	"fmt"
+	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -24,39 +26,66 @@ var itreeCmd = &cobra.Command{
 	RunE:  dependencyTree,
 }
 
+var forceCmd = &cobra.Command{
+	Use:   "force",
+	Short: "force directed graph visualization",
+	Long: `force directed graph visualization of the module graph. The page is
+self contained and requires no network access to be viewed. Modules are
+grouped according to --group-by, or by org if not specified, and can be
+filtered by group.`,
+	RunE: forceGraph,
+}
+
 func init() {
 	graphCmd.AddCommand(wheelCmd)
 	graphCmd.AddCommand(itreeCmd)
+	graphCmd.AddCommand(forceCmd)
 	must(pflagvar.RegisterFlagsInStruct(wheelCmd.Flags(), "graph", &graphState, nil, nil))
 	must(pflagvar.RegisterFlagsInStruct(itreeCmd.Flags(), "graph", &graphState, nil, nil))
+	must(pflagvar.RegisterFlagsInStruct(forceCmd.Flags(), "graph", &graphState, nil, nil))
 }
 
+// dependencyMatrix is a sparse dependency matrix for the modules in the
+// order supplied, the columns of the dependencies of the module in row i
+// are cols[offsets[i]:offsets[i+1]], in increasing order.
 type dependencyMatrix struct {
-	modules      []string
-	moduleIndex  map[string]int
-	dependencies [][]byte
+	modules []string
+	offsets []int32
+	cols    []int32
 }
 
-func newDM(modules []string) *dependencyMatrix {
+// newCompactDM creates the dependency matrix for the modules, in the order
+// supplied, directly from the CSR adjacency lists of the compact graph.
+func newCompactDM(cg *compactGraph, modules []string) *dependencyMatrix {
 	dm := &dependencyMatrix{
-		modules:      make([]string, len(modules)),
-		moduleIndex:  make(map[string]int, len(modules)),
-		dependencies: make([][]byte, len(modules)),
+		modules: make([]string, len(modules)),
+		offsets: make([]int32, len(modules)+1),
+		cols:    make([]int32, 0, len(cg.deps)),
 	}
 	copy(dm.modules, modules)
-	for i, v := range dm.modules {
-		dm.moduleIndex[v] = i
-		dm.dependencies[i] = make([]byte, len(modules))
+	position := make([]int32, len(cg.modules))
+	for i := range position {
+		position[i] = -1
 	}
-	return dm
-}
-
-func (dm *dependencyMatrix) addDeps(deps []dependency) {
-	for _, dep := range deps {
-		from := dm.moduleIndex[dep.Module]
-		to := dm.moduleIndex[dep.DependsOn]
-		dm.dependencies[from][to] = 0x1
+	for i, m := range modules {
+		if n, ok := cg.index[m]; ok {
+			position[n] = int32(i)
+		}
 	}
+	for i, m := range modules {
+		start := len(dm.cols)
+		if n, ok := cg.index[m]; ok {
+			for _, d := range cg.dependencies(n) {
+				if p := position[d]; p >= 0 {
+					dm.cols = append(dm.cols, p)
+				}
+			}
+		}
+		row := dm.cols[start:]
+		sort.Slice(row, func(i, j int) bool { return row[i] < row[j] })
+		dm.offsets[i+1] = int32(len(dm.cols))
+	}
+	return dm
 }
 
 func (dm *dependencyMatrix) moduleNames() string {
@@ -67,52 +96,85 @@ func (dm *dependencyMatrix) moduleNames() string {
 	return out.String()
 }
 
+// matrix returns the matrix as a javascript array of rows, each row is
+// copied from a row of zeros with the dependencies then set to 1.
 func (dm *dependencyMatrix) matrix() string {
-	var out strings.Builder
-	out.WriteString("[")
-	for i := 0; i < len(dm.dependencies); i++ {
-		out.WriteString("[")
-		for j := 0; j < len(dm.dependencies)-1; j++ {
-			if val := dm.dependencies[i][j]; val > 0 {
-				out.WriteString("1,")
-			} else {
-				out.WriteString("0,")
-			}
+	n := len(dm.modules)
+	zeros := make([]byte, 0, 2*n)
+	for j := 0; j < n; j++ {
+		if j > 0 {
+			zeros = append(zeros, ',')
 		}
-		if val := dm.dependencies[i][len(dm.dependencies)-1]; val > 0 {
-			out.WriteString("1]")
-		} else {
-			out.WriteString("0]")
+		zeros = append(zeros, '0')
+	}
+	out := make([]byte, 0, 2+n*(len(zeros)+4))
+	out = append(out, '[')
+	for i := 0; i < n; i++ {
+		out = append(out, '[')
+		row := len(out)
+		out = append(out, zeros...)
+		for _, c := range dm.cols[dm.offsets[i]:dm.offsets[i+1]] {
+			out[row+2*int(c)] = '1'
 		}
-		if i < len(dm.dependencies)-1 {
-			out.WriteString(",\n")
-			continue
+		out = append(out, ']')
+		if i < n-1 {
+			out = append(out, ",\n"...)
 		}
 	}
-	out.WriteString("]")
-	return out.String()
+	out = append(out, ']')
+	return string(out)
+}
+
+// groups returns a javascript array of the group index for each module
+// and the total number of groups.
+func (dm *dependencyMatrix) groups(grp grouper) string {
+	index := map[string]int{}
+	ids := make([]string, len(dm.modules))
+	for i, m := range dm.modules {
+		g := grp(m)
+		if _, ok := index[g]; !ok {
+			index[g] = len(index)
+		}
+		ids[i] = strconv.Itoa(index[g])
+	}
+	return fmt.Sprintf("{count: %v, ids: [%v]}", len(index), strings.Join(ids, ","))
 }
 
 func dependencyWheel(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
-	dependencies, _, ordered, err := getGraph(ctx, graphState.Versioned)
+	return writeDependencyWheel(context.Background(), cmd.OutOrStdout())
+}
+
+func writeDependencyWheel(ctx context.Context, out io.Writer) error {
+	dependencies, unique, ordered, err := getGraph(ctx, graphState.Versioned)
 	if err != nil {
 		return err
 	}
-	dm := newDM(ordered)
-	dm.addDeps(dependencies)
+	grp, err := newGrouper(graphState.GroupBy)
+	if err != nil {
+		return err
+	}
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return err
+	}
+	dm := newCompactDM(graph.compact(), ordered)
 	data := struct {
 		Name    string
 		Modules string
 		Matrix  string
+		Groups  string
 		JS      string
 	}{
 		Name:    ordered[0],
 		Modules: dm.moduleNames(),
 		Matrix:  dm.matrix(),
+		Groups:  "null",
 		JS:      dependencyWheelJS,
 	}
-	return dependencyWheelTmpl.Execute(os.Stdout, &data)
+	if grp != nil {
+		data.Groups = dm.groups(grp)
+	}
+	return dependencyWheelTmpl.Execute(out, &data)
 }
 
 /*
@@ -140,7 +202,8 @@ var dependencyWheelTmpl = template.Must(template.New("wheel").Parse(`<!DOCTYPE h
 
 var data = {
 	packageNames: {{.Modules}},
-	matrix: {{.Matrix}}
+	matrix: {{.Matrix}},
+	groups: {{.Groups}}
 };
 
 var chart = d3.chart.dependencyWheel();
@@ -155,19 +218,24 @@ d3.select('#chart_placeholder')
 
 // treeNodeJS is for use with
 type treeNodeJS struct {
-	Module   string        `json:"name"`
-	Cycle    string        `json:"cycle"`
-	Children []*treeNodeJS `json:"children,omitempty"`
+	Module   string          `json:"name"`
+	Version  string          `json:"version,omitempty"`
+	Cycle    string          `json:"cycle"`
+	Metadata *moduleMetadata `json:"metadata,omitempty"`
+	Usage    moduleUsage     `json:"usage,omitempty"`
+	Children []*treeNodeJS   `json:"children,omitempty"`
 }
 
-func forJSON(t *treeNode) *treeNodeJS {
+func forJSON(t *treeNode, versions map[string]string, metadata map[string]*moduleMetadata) *treeNodeJS {
 	tjs := &treeNodeJS{
-		Module: t.Module,
-		Cycle:  t.Cycle,
+		Module:   t.Module,
+		Version:  moduleVersion(t.Module, versions),
+		Cycle:    t.Cycle,
+		Metadata: metadata[t.Module],
 	}
 	tjs.Children = make([]*treeNodeJS, 0, len(t.Children))
 	for _, v := range t.Children {
-		tjs.Children = append(tjs.Children, forJSON(v))
+		tjs.Children = append(tjs.Children, forJSON(v, versions, metadata))
 	}
 	sort.Slice(tjs.Children, func(i, j int) bool {
 		return tjs.Children[i].Module < tjs.Children[j].Module
@@ -175,26 +243,105 @@ func forJSON(t *treeNode) *treeNodeJS {
 	return tjs
 }
 
+// setUsage records the usage of each module in the tree.
+func (tjs *treeNodeJS) setUsage(usage map[string]moduleUsage) {
+	tjs.Usage = usage[tjs.Module]
+	for _, c := range tjs.Children {
+		c.setUsage(usage)
+	}
+}
+
+// treesJS contains both the dependency and dependent trees so that
+// the page can switch between them without being regenerated.
+type treesJS struct {
+	Dependencies *treeNodeJS  `json:"dependencies"`
+	Dependents   *treeNodeJS  `json:"dependents"`
+	Diagnostics  *diagnostics `json:"diagnostics,omitempty"`
+}
+
+// newTreesJS returns the dependency and dependent trees of start, restricted
+// to the paths that include contains if it is specified.
+func newTreesJS(graph *graph, start, contains string, versions map[string]string, metadata map[string]*moduleMetadata) *treesJS {
+	tree := func(dependencies bool) *treeNodeJS {
+		t := graph.queryTree(start, contains, dependencies)
+		if t == nil {
+			t = &treeNode{Module: start}
+		}
+		return forJSON(t, versions, metadata)
+	}
+	return &treesJS{
+		Dependencies: tree(true),
+		Dependents:   tree(false),
+	}
+}
+
+// loadTreesJS returns the dependency and dependent trees of the module
+// specified by --start, or the root module, and the name of that module.
+// The selected versions are only loaded if the modules are not versioned,
+// so that they can be displayed, or if --classify requires them.
+func loadTreesJS(ctx context.Context) (*treesJS, string, error) {
+	graph, start, grp, err := loadQueryGraph(ctx, graphState.Start, graphState.Versioned)
+	if err != nil {
+		return nil, "", err
+	}
+	var versions map[string]string
+	if !graphState.Versioned || graphState.Classify {
+		if versions, err = getSelectedVersions(ctx, goCmd{}); err != nil {
+			return nil, "", err
+		}
+	}
+	modules := make([]string, 0, len(graph.nodes))
+	for m := range graph.nodes {
+		modules = append(modules, m)
+	}
+	var metadata map[string]*moduleMetadata
+	if graphState.Metadata {
+		if metadata, err = loadMetadata(ctx, modules, versions); err != nil {
+			return nil, "", err
+		}
+	}
+	contains := graphState.Contains
+	if grp != nil && len(contains) > 0 {
+		contains = grp(contains)
+	}
+	trees := newTreesJS(graph, start, contains, versions, metadata)
+	trees.Diagnostics = moduleDiagnostics.orNil()
+	if graphState.Classify {
+		usage, err := loadUsage(ctx, modules, versions)
+		if err != nil {
+			return nil, "", err
+		}
+		trees.Dependencies.setUsage(usage)
+		trees.Dependents.setUsage(usage)
+	}
+	return trees, start, nil
+}
+
 func dependencyTree(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
-	tree, err := runQuery(ctx, graphState.Start, graphState.Contains, graphState.Versioned)
+	return writeDependencyTree(context.Background(), cmd.OutOrStdout())
+}
+
+func writeDependencyTree(ctx context.Context, out io.Writer) error {
+	trees, start, err := loadTreesJS(ctx)
 	if err != nil {
 		return err
 	}
-	buf, err := json.MarshalIndent(forJSON(tree), "", "  ")
+	buf, err := json.MarshalIndent(trees, "", "  ")
 	if err != nil {
 		return err
 	}
 	data := struct {
-		Name     string
-		TreeData string
-		JS       string
+		Name         string
+		TreeData     string
+		Dependencies bool
+		JS           string
 	}{
-		Name:     graphState.Start,
-		TreeData: string(buf),
-		JS:       treeJS,
+		Name:         start,
+		TreeData:     string(buf),
+		Dependencies: graphState.Dependencies,
+		JS:           treeJS,
 	}
-	return dependencyTreeTmpl.Execute(os.Stdout, &data)
+	return dependencyTreeTmpl.Execute(out, &data)
 }
 
 var dependencyTreeTmpl = template.Must(template.New("wheel").Parse(`<!DOCTYPE html>
@@ -239,6 +386,39 @@ var dependencyTreeTmpl = template.Must(template.New("wheel").Parse(`<!DOCTYPE ht
   stroke-width: 3px;
 }
 
+#controls {
+  position: absolute;
+  top: 8px;
+  left: 8px;
+  background: rgba(255, 255, 255, 0.9);
+  padding: 4px;
+}
+
+.node.found text {
+  font-weight: bold;
+  fill: #E94762;
+}
+
+.node.deprecated text {
+  fill: #D62728;
+  text-decoration: line-through;
+}
+
+.node.onpath circle {
+  stroke: orangered;
+  stroke-width: 3px;
+}
+
+.link.onpath {
+  stroke: orangered;
+  stroke-width: 3px;
+}
+
+.link.test {
+  stroke: #1F77B4;
+  stroke-dasharray: 5,3;
+}
+
 .ghostCircle.show{
   display:block;
 }
@@ -250,11 +430,211 @@ var dependencyTreeTmpl = template.Must(template.New("wheel").Parse(`<!DOCTYPE ht
 <script src="https://code.jquery.com/jquery-1.10.2.min.js"></script>
 <script src="https://d3js.org/d3.v3.min.js"></script>
 <body>
+    <div id="controls">
+      <input id="search" type="text" placeholder="search modules" size="40">
+      <button id="path">show path to root</button>
+      <button id="direction"></button>
+      <span id="status"></span>
+    </div>
     <div id="tree-container"></div>
 <script>
 {{.JS}}
 let treeData = {{.TreeData}};
-displayTree(treeData);
+let dependencies = {{.Dependencies}};
+let display;
+
+function showTree() {
+  d3.select("#tree-container").selectAll("*").remove();
+  display = displayTree(dependencies ? treeData.dependencies : treeData.dependents);
+  $("#direction").text(dependencies ? "show dependents" : "show dependencies");
+  $("#status").text("");
+  $("#search").val("");
+}
+
+$("#search").on("keyup", function(e) {
+  if (e.key === "Enter") {
+    let n = display.search($(this).val().trim());
+    $("#status").text(n + " occurrences");
+  }
+});
+$("#path").on("click", function() {
+  display.pathToRoot();
+});
+$("#direction").on("click", function() {
+  dependencies = !dependencies;
+  showTree();
+});
+showTree();
+</script>
+</body>
+</html>
+`))
+
+type forceNodeJS struct {
+	Module string `json:"name"`
+	Group  string `json:"group"`
+}
+
+type forceLinkJS struct {
+	Source int  `json:"source"`
+	Target int  `json:"target"`
+	Cycle  bool `json:"cycle,omitempty"`
+}
+
+type forceGraphJS struct {
+	Nodes       []forceNodeJS `json:"nodes"`
+	Links       []forceLinkJS `json:"links"`
+	Diagnostics *diagnostics  `json:"diagnostics,omitempty"`
+}
+
+// forceData returns the nodes and links of the graph, with links that
+// are part of a cycle marked as such. The first node is the root.
+func forceData(dependencies []dependency, unique map[string]bool, ordered []string, grp grouper) (*forceGraphJS, error) {
+	graph, err := buildGraph(dependencies, unique, moduleDiagnostics)
+	if err != nil {
+		return nil, err
+	}
+	components := graph.components()
+	index := make(map[string]int, len(ordered))
+	data := &forceGraphJS{
+		Nodes: make([]forceNodeJS, len(ordered)),
+		Links: make([]forceLinkJS, len(dependencies)),
+	}
+	for i, m := range ordered {
+		index[m] = i
+		data.Nodes[i] = forceNodeJS{Module: m, Group: grp(m)}
+	}
+	for i, dep := range dependencies {
+		data.Links[i] = forceLinkJS{
+			Source: index[dep.Module],
+			Target: index[dep.DependsOn],
+			Cycle:  components[dep.Module] == components[dep.DependsOn],
+		}
+	}
+	return data, nil
+}
+
+// loadForceData returns the data for the force directed graph and the
+// name of the root module.
+func loadForceData(ctx context.Context) (*forceGraphJS, string, error) {
+	dependencies, unique, ordered, err := getGraph(ctx, graphState.Versioned)
+	if err != nil {
+		return nil, "", err
+	}
+	grp, err := newGrouper(graphState.GroupBy)
+	if err != nil {
+		return nil, "", err
+	}
+	if grp == nil {
+		grp = prefixGrouper(2)
+	}
+	fd, err := forceData(dependencies, unique, ordered, grp)
+	if err != nil {
+		return nil, "", err
+	}
+	fd.Diagnostics = moduleDiagnostics.orNil()
+	return fd, ordered[0], nil
+}
+
+func forceGraph(cmd *cobra.Command, args []string) error {
+	return writeForceGraph(context.Background(), cmd.OutOrStdout())
+}
+
+func writeForceGraph(ctx context.Context, out io.Writer) error {
+	fd, name, err := loadForceData(ctx)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(fd)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Name      string
+		GraphData string
+		JS        string
+	}{
+		Name:      name,
+		GraphData: string(buf),
+		JS:        forceJS,
+	}
+	return forceTmpl.Execute(out, &data)
+}
+
+var forceTmpl = template.Must(template.New("force").Parse(`<!DOCTYPE html>
+<meta charset="utf-8">
+<title>Dependency Graph for {{.Name}}</title>
+<style type="text/css">
+
+body {
+  margin: 0;
+  font-family: sans-serif;
+}
+
+#controls {
+  position: absolute;
+  top: 8px;
+  left: 8px;
+  background: rgba(255, 255, 255, 0.9);
+  padding: 4px;
+}
+
+#graph {
+  width: 100vw;
+  height: 100vh;
+  background-color: #EEE;
+}
+
+.node circle {
+  stroke: #fff;
+  stroke-width: 1.5px;
+  cursor: pointer;
+}
+
+.node text {
+  font-size: 10px;
+  pointer-events: none;
+}
+
+.link {
+  stroke: #999;
+  stroke-opacity: 0.6;
+}
+
+.link.cycle {
+  stroke: red;
+}
+
+.faded {
+  opacity: 0.1;
+}
+
+.link.dependency {
+  stroke: steelblue;
+  stroke-opacity: 1;
+}
+
+.link.dependent {
+  stroke: darkorange;
+  stroke-opacity: 1;
+}
+
+.node.matched circle {
+  stroke: black;
+  stroke-width: 3px;
+}
+</style>
+<body>
+<div id="controls">
+  <input id="search" type="text" placeholder="search modules" size="40">
+  <select id="group"><option value="">all groups</option></select>
+  <span id="status"></span>
+</div>
+<svg id="graph"></svg>
+<script>
+{{.JS}}
+let graphData = {{.GraphData}};
+displayForceGraph(graphData);
 </script>
 </body>
 </html>
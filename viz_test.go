@@ -0,0 +1,62 @@
+// Copyright 2019 Cosmos Nicolaou. All rights reserved.
+// Use of this source code is governed by the Apache-2.0
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForceData(t *testing.T) {
+	fx := loadFixture(t, "cyclic")
+	dependencies, unique, ordered := processGraph(fx.raw, false)
+	fd, err := forceData(dependencies, unique, ordered, prefixGrouper(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fd.Nodes, []forceNodeJS{
+		{Module: "example.com/app", Group: "example.com/app"},
+		{Module: "example.com/x", Group: "example.com/x"},
+		{Module: "example.com/y", Group: "example.com/y"},
+		{Module: "example.com/z", Group: "example.com/z"},
+		{Module: "example.com/w", Group: "example.com/w"},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Only the link to w is not part of the app, x, y, z cycle.
+	if got, want := fd.Links, []forceLinkJS{
+		{Source: 0, Target: 1, Cycle: true},
+		{Source: 0, Target: 2, Cycle: true},
+		{Source: 1, Target: 2, Cycle: true},
+		{Source: 2, Target: 3, Cycle: true},
+		{Source: 3, Target: 1, Cycle: true},
+		{Source: 3, Target: 0, Cycle: true},
+		{Source: 1, Target: 4},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	fx = loadFixture(t, "small")
+	dependencies, unique, ordered = processGraph(fx.raw, false)
+	fd, err = forceData(dependencies, unique, ordered, prefixGrouper(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(fd.Nodes), len(ordered); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := fd.Nodes[0].Module, fx.root; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i, l := range fd.Links {
+		if l.Cycle {
+			t.Errorf("%v: unexpected cycle: %v -> %v", i, fd.Nodes[l.Source].Module, fd.Nodes[l.Target].Module)
+		}
+		dep := dependency{Module: fd.Nodes[l.Source].Module, DependsOn: fd.Nodes[l.Target].Module}
+		if got, want := dep, dependencies[i]; got != want {
+			t.Errorf("%v: got %v, want %v", i, got, want)
+		}
+	}
+}